@@ -0,0 +1,120 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// ****************************************************************************
+// startAlerts()
+// ****************************************************************************
+// Subscribes the desktop notifications to the state changes of the bus
+func startAlerts() {
+	s := bus.Subscribe("alerts")
+	On(s, &bus.States, notifyStateChange)
+	On(s, &bus.Flaps, func(c FlapChange) { notifyFlapChange(c.Monitor, c.Flapping) })
+	On(s, &bus.Anomalies, func(c AnomalyChange) { notifyAnomaly(c.Monitor, c.Anomaly) })
+}
+
+// ****************************************************************************
+// notifyStateChange()
+// ****************************************************************************
+func notifyStateChange(c StateChange) {
+	// The first successful probe is not worth an alert
+	if c.From == StateUnknown && c.To == StateUp {
+		return
+	}
+	// A flapping target gets one alert when it starts and one when it stops
+	if c.Flapping {
+		return
+	}
+	// Children of a down target are covered by the alert on their parent
+	if c.To == StateUnreachable || c.From == StateUnreachable && c.To == StateUp {
+		return
+	}
+	// Samples are still recorded, only the notification is muted
+	if isSilenced(c.Monitor.Config.Address, time.Now()) {
+		return
+	}
+
+	severity := SeverityInfo
+	if c.To == StateDown {
+		severity = SeverityError
+	}
+	sendAlert(stateMessage(c.Monitor, c.To), severity)
+}
+
+// ****************************************************************************
+// notifyFlapChange()
+// ****************************************************************************
+func notifyFlapChange(m *Monitor, flapping bool) {
+	if isSilenced(m.Config.Address, time.Now()) {
+		return
+	}
+
+	severity := SeverityInfo
+	if flapping {
+		severity = SeverityWarning
+	}
+	sendAlert(flapMessage(m, flapping), severity)
+}
+
+// ****************************************************************************
+// notifyAnomaly()
+// ****************************************************************************
+func notifyAnomaly(m *Monitor, anomaly bool) {
+	if !currentSettings().AnomalyAlerts || isSilenced(m.Config.Address, time.Now()) {
+		return
+	}
+
+	if m.Stats().Flapping {
+		return
+	}
+	severity := SeverityInfo
+	if anomaly {
+		severity = SeverityWarning
+	}
+	sendAlert(anomalyMessage(m, anomaly), severity)
+}
+
+// ****************************************************************************
+// sendAlert()
+// ****************************************************************************
+func sendAlert(message string, severity Severity) {
+	fyne.CurrentApp().SendNotification(fyne.NewNotification(AppTitle, message))
+	publishStatus(severity, message)
+}
+
+// ****************************************************************************
+// stateMessage()
+// ****************************************************************************
+func stateMessage(m *Monitor, to TargetState) string {
+	return fmt.Sprintf("%s is %s", m.DisplayName(), to)
+}
+
+// ****************************************************************************
+// flapMessage()
+// ****************************************************************************
+func flapMessage(m *Monitor, flapping bool) string {
+	stats := m.Stats()
+	if flapping {
+		return fmt.Sprintf("%s is flapping (score %.0f%%)", m.DisplayName(), stats.FlapScore)
+	}
+	return fmt.Sprintf("%s stopped flapping, now %s", m.DisplayName(), stats.State)
+}
+
+// ****************************************************************************
+// anomalyMessage()
+// ****************************************************************************
+func anomalyMessage(m *Monitor, anomaly bool) string {
+	stats := m.Stats()
+	if anomaly {
+		return fmt.Sprintf("%s latency anomaly : %.1f ms is %.1f sigmas off its baseline", m.DisplayName(), stats.Last, stats.Sigmas)
+	}
+	return fmt.Sprintf("%s latency back to its baseline (%.1f ms)", m.DisplayName(), stats.Last)
+}
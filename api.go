@@ -0,0 +1,274 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// TargetView is how a target is exposed by the REST API
+type TargetView struct {
+	TargetConfig
+	Hostname string      `json:"hostname"`
+	Running  bool        `json:"running"`
+	Silenced bool        `json:"silenced"`
+	Stats    TargetStats `json:"stats"`
+}
+
+// ****************************************************************************
+// newTargetView()
+// ****************************************************************************
+func newTargetView(m *Monitor) TargetView {
+	return TargetView{
+		TargetConfig: m.Config,
+		Hostname:     m.Hostname(),
+		Running:      m.Running(),
+		Silenced:     isSilenced(m.Config.Address, time.Now()),
+		Stats:        m.Stats(),
+	}
+}
+
+// ****************************************************************************
+// startAPIServer()
+// ****************************************************************************
+// Serves the REST API, every request must carry "Authorization: Bearer <token>"
+// or, for browsers which cannot set headers on streams, "?token=<token>"
+func startAPIServer(e *Engine, address string, port int, token string) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, requireToken(token, newAPIHandler(e)))
+	return nil
+}
+
+// ****************************************************************************
+// newAPIHandler()
+// ****************************************************************************
+func newAPIHandler(e *Engine) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/targets", listTargets(e))
+
+	mux.HandleFunc("POST /api/targets", func(w http.ResponseWriter, r *http.Request) {
+		var cfg TargetConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil || cfg.Address == "" {
+			writeError(w, http.StatusBadRequest, "expected a JSON target with at least an address")
+			return
+		}
+		m := e.TryAdd(cfg)
+		if m == nil {
+			writeError(w, http.StatusConflict, cfg.Address+" is already monitored")
+			return
+		}
+		if !cfg.Paused {
+			m.Start()
+		}
+		saveTargets()
+		writeJSON(w, http.StatusCreated, newTargetView(m))
+	})
+
+	mux.HandleFunc("GET /api/targets/{address}", func(w http.ResponseWriter, r *http.Request) {
+		if m := findTarget(e, w, r); m != nil {
+			writeJSON(w, http.StatusOK, newTargetView(m))
+		}
+	})
+
+	mux.HandleFunc("PUT /api/targets/{address}", func(w http.ResponseWriter, r *http.Request) {
+		m := findTarget(e, w, r)
+		if m == nil {
+			return
+		}
+		cfg := m.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil || cfg.Address == "" {
+			writeError(w, http.StatusBadRequest, "expected a JSON target")
+			return
+		}
+		if m = e.Update(m.Config.Address, cfg); m == nil {
+			writeError(w, http.StatusConflict, cfg.Address+" is already monitored or was removed")
+			return
+		}
+		saveTargets()
+		writeJSON(w, http.StatusOK, newTargetView(m))
+	})
+
+	mux.HandleFunc("DELETE /api/targets/{address}", func(w http.ResponseWriter, r *http.Request) {
+		if m := findTarget(e, w, r); m != nil {
+			e.Remove(m.Config.Address)
+			saveTargets()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	mux.HandleFunc("POST /api/targets/{address}/pause", func(w http.ResponseWriter, r *http.Request) {
+		setPaused(e, w, r, true)
+	})
+
+	mux.HandleFunc("POST /api/targets/{address}/resume", func(w http.ResponseWriter, r *http.Request) {
+		setPaused(e, w, r, false)
+	})
+
+	// Zeroes the running statistics, the history being kept
+	mux.HandleFunc("POST /api/targets/{address}/reset", func(w http.ResponseWriter, r *http.Request) {
+		if m := findTarget(e, w, r); m != nil {
+			m.ResetStats()
+			writeJSON(w, http.StatusOK, newTargetView(m))
+		}
+	})
+
+	mux.HandleFunc("GET /api/targets/{address}/history", targetHistory(e))
+	mux.HandleFunc("GET /api/incidents", listIncidents)
+
+	// Live samples and state transitions, filtered by ?target= and ?group=
+	mux.HandleFunc("GET /api/stream", serveSSE)
+	mux.HandleFunc("GET /api/ws", serveWebSocket)
+
+	return mux
+}
+
+// ****************************************************************************
+// setPaused()
+// ****************************************************************************
+func setPaused(e *Engine, w http.ResponseWriter, r *http.Request, paused bool) {
+	address := r.PathValue("address")
+	m := e.SetPaused(address, paused)
+	if m == nil {
+		writeError(w, http.StatusNotFound, address+" is not monitored")
+		return
+	}
+	saveTargets()
+	writeJSON(w, http.StatusOK, newTargetView(m))
+}
+
+// ****************************************************************************
+// listTargets()
+// ****************************************************************************
+func listTargets(e *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		views := []TargetView{}
+		for _, m := range e.Monitors() {
+			views = append(views, newTargetView(m))
+		}
+		writeJSON(w, http.StatusOK, views)
+	}
+}
+
+// ****************************************************************************
+// targetHistory()
+// ****************************************************************************
+// ?since= takes a RFC 3339 time or a duration back from now, e.g. 30m
+func targetHistory(e *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := findTarget(e, w, r)
+		if m == nil {
+			return
+		}
+		since, err := parseSince(r.URL.Query().Get("since"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		samples, err := loadHistory(m.Config.Address, since)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if samples == nil {
+			samples = []Sample{}
+		}
+		writeJSON(w, http.StatusOK, samples)
+	}
+}
+
+// ****************************************************************************
+// listIncidents()
+// ****************************************************************************
+// ?target= restricts the log to one address
+func listIncidents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Incidents(r.URL.Query().Get("target")))
+}
+
+// ****************************************************************************
+// requireToken()
+// ****************************************************************************
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			given, ok = r.URL.Query().Get("token"), r.URL.Query().Has("token")
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ****************************************************************************
+// findTarget()
+// ****************************************************************************
+// Returns the target named in the URL, or writes a 404 and returns nil
+func findTarget(e *Engine, w http.ResponseWriter, r *http.Request) *Monitor {
+	address := r.PathValue("address")
+	m := e.Find(address)
+	if m == nil {
+		writeError(w, http.StatusNotFound, address+" is not monitored")
+	}
+	return m
+}
+
+// ****************************************************************************
+// parseSince()
+// ****************************************************************************
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().Add(-time.Hour), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since must be a RFC 3339 time or a duration, not %q", value)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// ****************************************************************************
+// writeJSON()
+// ****************************************************************************
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ****************************************************************************
+// writeError()
+// ****************************************************************************
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// ****************************************************************************
+// newAPIToken()
+// ****************************************************************************
+func newAPIToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// useTestHome()
+// ****************************************************************************
+// Moves the app folder and the settings file to a temporary folder
+func useTestHome(t *testing.T) {
+	t.Helper()
+	appHome = t.TempDir()
+	configPath = filepath.Join(appHome, "config.json")
+	settings = AppSettings{}
+	t.Cleanup(func() { appHome, configPath = "", "" })
+}
+
+// ****************************************************************************
+// newTestEngine()
+// ****************************************************************************
+// Returns an engine whose probes are always answered in 1 ms, without
+// running ping
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	e := NewEngine(time.Duration(DefaultPingInterval) * time.Second)
+	e.prober = func(address string) Sample { return Sample{Time: time.Now(), RTT: 1} }
+	t.Cleanup(func() {
+		for _, m := range e.Monitors() {
+			m.Stop()
+		}
+		e.Wait()
+	})
+	return e
+}
+
+// ****************************************************************************
+// newTestAPI()
+// ****************************************************************************
+// Serves the API of a fresh engine, the settings being saved in a temporary
+// folder
+func newTestAPI(t *testing.T) (*httptest.Server, *Engine) {
+	t.Helper()
+	useTestHome(t)
+	engine = newTestEngine(t)
+	server := httptest.NewServer(newAPIHandler(engine))
+	t.Cleanup(server.Close)
+	return server, engine
+}
+
+// ****************************************************************************
+// TestAPIAddOnce()
+// ****************************************************************************
+func TestAPIAddOnce(t *testing.T) {
+	server, e := newTestAPI(t)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(server.URL+"/api/targets", "application/json",
+				strings.NewReader(`{"address":"192.0.2.1","paused":true}`))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if created != 1 || len(e.Monitors()) != 1 {
+		t.Errorf("%d created, %d monitored, want 1 and 1", created, len(e.Monitors()))
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config.json mode %v, want 0600", info.Mode().Perm())
+	}
+}
+
+// ****************************************************************************
+// TestAPIResumeWithPut()
+// ****************************************************************************
+func TestAPIResumeWithPut(t *testing.T) {
+	server, e := newTestAPI(t)
+	e.Add(TargetConfig{Address: "192.0.2.1", Name: "test", Paused: true}) // Named, not resolved
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/targets/192.0.2.1", strings.NewReader(`{"paused":false}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	m := e.Find("192.0.2.1")
+	if m.Config.Paused || !m.Running() {
+		t.Errorf("paused %v, running %v, want a resumed target", m.Config.Paused, m.Running())
+	}
+
+	e.Remove("192.0.2.1")
+	resp, err = http.Post(server.URL+"/api/targets/192.0.2.1/pause", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("pausing a removed target : status %d, want 404", resp.StatusCode)
+	}
+}
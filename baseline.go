@@ -0,0 +1,129 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// Baseline is the learned latency of a target : an exponentially weighted
+// moving average of the RTT and of its deviation, as TCP does for its RTO
+type Baseline struct {
+	Mean  float64 `json:"mean"`
+	Dev   float64 `json:"dev"`
+	Count int     `json:"count"`
+}
+
+// BaselineSet holds the overall baseline of a target plus one per hour of
+// the week, for links whose latency follows the office hours
+type BaselineSet struct {
+	Global Baseline      `json:"global"`
+	Hourly [168]Baseline `json:"hourly"`
+}
+
+// ****************************************************************************
+// update()
+// ****************************************************************************
+func (b *Baseline) update(rtt float64) {
+	if b.Count == 0 {
+		b.Mean = rtt
+		b.Dev = rtt / 2
+	} else {
+		b.Dev += BaselineBeta * (math.Abs(rtt-b.Mean) - b.Dev)
+		b.Mean += BaselineAlpha * (rtt - b.Mean)
+	}
+	b.Count++
+}
+
+// ****************************************************************************
+// sigmas()
+// ****************************************************************************
+// Returns how many deviations rtt is away from the mean, 0 while still learning
+func (b *Baseline) sigmas(rtt float64) float64 {
+	if b.Count < BaselineWarmup {
+		return 0
+	}
+	return math.Abs(rtt-b.Mean) / math.Max(b.Dev, BaselineMinDeviation)
+}
+
+// ****************************************************************************
+// hourOfWeek()
+// ****************************************************************************
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// ****************************************************************************
+// reference()
+// ****************************************************************************
+// Returns the baseline a sample taken at t is compared with
+func (bs *BaselineSet) reference(t time.Time, perHour bool) *Baseline {
+	if perHour {
+		if hourly := &bs.Hourly[hourOfWeek(t)]; hourly.Count >= BaselineWarmup {
+			return hourly
+		}
+	}
+	return &bs.Global
+}
+
+// ****************************************************************************
+// observe()
+// ****************************************************************************
+// Scores rtt against the baseline then learns from it
+func (bs *BaselineSet) observe(t time.Time, rtt float64, perHour bool) float64 {
+	sigmas := bs.reference(t, perHour).sigmas(rtt)
+	bs.Global.update(rtt)
+	bs.Hourly[hourOfWeek(t)].update(rtt)
+	return sigmas
+}
+
+// ****************************************************************************
+// anomalySigmas()
+// ****************************************************************************
+func anomalySigmas() float64 {
+	if sigmas := currentSettings().AnomalySigmas; sigmas > 0 {
+		return sigmas
+	}
+	return DefaultAnomalySigmas
+}
+
+// ****************************************************************************
+// loadBaselines()
+// ****************************************************************************
+func loadBaselines() (map[string]BaselineSet, error) {
+	path, _ := getAppFolderPath(AppFolderName)
+	baselines := make(map[string]BaselineSet)
+	data, err := os.ReadFile(filepath.Join(path, BaselinesFileName))
+	if err != nil {
+		return baselines, err // Nothing learned yet
+	}
+	err = json.Unmarshal(data, &baselines)
+	return baselines, err
+}
+
+// ****************************************************************************
+// saveBaselines()
+// ****************************************************************************
+func saveBaselines(e *Engine) error {
+	path, err := getAppFolderPath(AppFolderName)
+	if err != nil {
+		return err
+	}
+	baselines := make(map[string]BaselineSet)
+	for _, m := range e.Monitors() {
+		baselines[m.Config.Address] = m.Baseline()
+	}
+	data, err := json.Marshal(baselines)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, BaselinesFileName), data, AppFileMode)
+}
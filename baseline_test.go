@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TestBaselineEWMA()
+// ****************************************************************************
+// The first sample seeds the mean, the next ones move it by BaselineAlpha
+// and the deviation by BaselineBeta. Nothing is anomalous during the warm-up.
+func TestBaselineEWMA(t *testing.T) {
+	var b Baseline
+	b.update(10)
+	if b.Mean != 10 || b.Dev != 5 || b.Count != 1 {
+		t.Errorf("after the first sample %+v", b)
+	}
+	b.update(18)
+	if b.Mean != 11 || b.Dev != 5.75 || b.Count != 2 {
+		t.Errorf("after the second sample %+v, want mean 11, dev 5.75", b)
+	}
+
+	b = Baseline{}
+	for range BaselineWarmup - 1 {
+		b.update(10)
+	}
+	if sigmas := b.sigmas(1000); sigmas != 0 {
+		t.Errorf("%v sigmas during the warm-up", sigmas)
+	}
+	b.update(10)
+	// The deviation of a steady link fades, BaselineMinDeviation is used
+	if sigmas := b.sigmas(12); math.Abs(sigmas-2/BaselineMinDeviation) > 1e-9 {
+		t.Errorf("%v sigmas, want %v", sigmas, 2/BaselineMinDeviation)
+	}
+}
+
+// ****************************************************************************
+// TestBaselinePerHour()
+// ****************************************************************************
+// An hour of the week is compared with its own baseline once warmed up, with
+// the global one before or when the hourly baselines are off
+func TestBaselinePerHour(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	office, night, dawn := monday.Add(10*time.Hour), monday.Add(3*time.Hour), monday.Add(4*time.Hour)
+	for _, c := range []struct {
+		at   time.Time
+		want int
+	}{
+		{time.Date(2026, 10, 18, 0, 30, 0, 0, time.Local), 0}, // Sunday
+		{office, 34},
+		{time.Date(2026, 10, 24, 23, 59, 0, 0, time.Local), 167}, // Saturday
+	} {
+		if got := hourOfWeek(c.at); got != c.want {
+			t.Errorf("hourOfWeek(%s) = %d, want %d", c.at.Format(time.DateTime), got, c.want)
+		}
+	}
+
+	var bs BaselineSet
+	for range BaselineWarmup {
+		bs.observe(office, 50, true)
+		bs.observe(night, 10, true)
+	}
+	for _, c := range []struct {
+		at      time.Time
+		perHour bool
+		want    *Baseline
+	}{
+		{office, true, &bs.Hourly[hourOfWeek(office)]},
+		{night, true, &bs.Hourly[hourOfWeek(night)]},
+		{dawn, true, &bs.Global},
+		{night, false, &bs.Global},
+	} {
+		if got := bs.reference(c.at, c.perHour); got != c.want {
+			t.Errorf("%s, per hour %v : reference with mean %v, want %v", c.at.Format(time.TimeOnly), c.perHour, got.Mean, c.want.Mean)
+		}
+	}
+	if night := bs.Hourly[hourOfWeek(night)]; night.Mean != 10 || night.Count != BaselineWarmup {
+		t.Errorf("night baseline %+v", night)
+	}
+	if bs.Global.Count != 2*BaselineWarmup {
+		t.Errorf("global baseline of %d samples", bs.Global.Count)
+	}
+}
+
+// ****************************************************************************
+// TestAnomaly()
+// ****************************************************************************
+// AnomalyAfter samples in a row beyond the sigma threshold raise an anomaly,
+// the first normal one clears it
+func TestAnomaly(t *testing.T) {
+	useTestHome(t)
+	spikes := []float64{100, 300, 1000, 10}
+	probe := func(m *Monitor, rtts ...float64) (anomalies []bool, changed []bool) {
+		at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.Local)
+		for _, rtt := range rtts {
+			changes := m.record(Sample{Time: at, RTT: rtt}, false)
+			anomalies = append(anomalies, m.Stats().Anomaly)
+			changed = append(changed, changes.anomalyChanged)
+		}
+		return anomalies, changed
+	}
+	warm := func() *Monitor {
+		m := NewEngine(time.Second).Add(TargetConfig{Address: "192.0.2.1"})
+		for range BaselineWarmup {
+			probe(m, 10)
+		}
+		return m
+	}
+
+	anomalies, changed := probe(warm(), spikes...)
+	for idx, want := range []bool{false, false, true, false} {
+		if anomalies[idx] != want || changed[idx] != (idx >= 2) {
+			t.Errorf("sample %v : anomaly %v, changed %v", spikes[idx], anomalies[idx], changed[idx])
+		}
+	}
+
+	// A higher threshold ignores the same spikes
+	if err := updateSettings(func(s *AppSettings) { s.AnomalySigmas = 20 }); err != nil {
+		t.Fatal(err)
+	}
+	anomalies, _ = probe(warm(), spikes...)
+	for idx, anomaly := range anomalies {
+		if anomaly {
+			t.Errorf("sample %v : anomaly with a threshold of 20 sigmas", spikes[idx])
+		}
+	}
+}
+
+// ****************************************************************************
+// TestSaveBaselines()
+// ****************************************************************************
+func TestSaveBaselines(t *testing.T) {
+	useTestHome(t)
+	e := NewEngine(time.Second)
+	m := e.Add(TargetConfig{Address: "192.0.2.1"})
+	m.record(Sample{Time: time.Now(), RTT: 12}, false)
+	if err := saveBaselines(e); err != nil {
+		t.Fatal(err)
+	}
+
+	folder := filepath.Join(appHome, AppFolderName)
+	for path, want := range map[string]os.FileMode{
+		folder:                                   AppFolderMode,
+		filepath.Join(folder, BaselinesFileName): AppFileMode,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s mode %v, want %v", path, info.Mode().Perm(), want)
+		}
+	}
+	baselines, err := loadBaselines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := baselines["192.0.2.1"].Global; got.Mean != 12 || got.Count != 1 {
+		t.Errorf("loaded baseline %+v", got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// ProbeResult is published after each probe, once the statistics are updated
+type ProbeResult struct {
+	Monitor *Monitor
+	Sample  Sample
+}
+
+// StateChange is published when a target goes up, down or unreachable,
+// Flapping telling whether it was flapping at that time
+type StateChange struct {
+	Monitor  *Monitor
+	From     TargetState
+	To       TargetState
+	Flapping bool
+}
+
+// FlapChange is published when a target starts or stops flapping
+type FlapChange struct {
+	Monitor  *Monitor
+	Flapping bool
+}
+
+// AnomalyChange is published when the latency leaves or rejoins its baseline
+type AnomalyChange struct {
+	Monitor *Monitor
+	Anomaly bool
+}
+
+// RouteChange is published when the route to a target changed : Old and New
+// are the hops found by two traceroutes, or OldTTL and NewTTL the TTLs of the
+// echo replies when they changed
+type RouteChange struct {
+	Monitor *Monitor
+	Old     []string
+	New     []string
+	OldTTL  int
+	NewTTL  int
+}
+
+// ConfigChange is published when targets are added, removed or modified
+type ConfigChange struct {
+	Targets []TargetConfig
+}
+
+// StatusMessage is a message for the status bar
+type StatusMessage struct {
+	Time     time.Time
+	Severity Severity
+	Text     string
+}
+
+// UpdateAvailable is published when a newer version is found on GitHub
+type UpdateAvailable struct {
+	Remote string // Hash of the latest commit
+}
+
+// Bus dispatches the events of the engine and of the application to the
+// subscribers (user interface, alerts, outputs, logging...). Publishing never
+// blocks : each subscriber has its own bounded queue and goroutine, a full
+// queue drops the event and counts it, so one slow subscriber cannot delay
+// the probes nor the other subscribers.
+type Bus struct {
+	Samples     Topic[ProbeResult]
+	States      Topic[StateChange]
+	Flaps       Topic[FlapChange]
+	Anomalies   Topic[AnomalyChange]
+	Routes      Topic[RouteChange]
+	Config      Topic[ConfigChange]
+	Status      Topic[StatusMessage]
+	Updates     Topic[UpdateAvailable]
+	mu          sync.Mutex
+	subscribers []*Subscriber
+}
+
+// Topic carries one type of event
+type Topic[T any] struct {
+	mu       sync.Mutex
+	handlers []topicHandler[T]
+}
+
+type topicHandler[T any] struct {
+	subscriber *Subscriber
+	handle     func(T)
+}
+
+// Subscriber runs its handlers one at a time, in the order the events were
+// published whatever their topic
+type Subscriber struct {
+	Name     string
+	queue    chan func()
+	dropped  atomic.Uint64
+	reported uint64 // Drops already logged, only used by run()
+}
+
+// BusDrops is the number of events a subscriber lost since pingo started
+type BusDrops struct {
+	Subscriber string
+	Dropped    uint64
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var bus = &Bus{}
+
+// ****************************************************************************
+// Subscribe()
+// ****************************************************************************
+// Creates a subscriber, its handlers being added with On()
+func (b *Bus) Subscribe(name string) *Subscriber {
+	s := &Subscriber{Name: name, queue: make(chan func(), BusBuffer)}
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, s)
+	b.mu.Unlock()
+	go s.run()
+	return s
+}
+
+// ****************************************************************************
+// Drops()
+// ****************************************************************************
+func (b *Bus) Drops() []BusDrops {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	drops := make([]BusDrops, 0, len(b.subscribers))
+	for _, s := range b.subscribers {
+		drops = append(drops, BusDrops{Subscriber: s.Name, Dropped: s.dropped.Load()})
+	}
+	return drops
+}
+
+// ****************************************************************************
+// On()
+// ****************************************************************************
+// Makes the subscriber handle the events of a topic
+func On[T any](s *Subscriber, topic *Topic[T], handle func(T)) {
+	topic.mu.Lock()
+	topic.handlers = append(topic.handlers, topicHandler[T]{subscriber: s, handle: handle})
+	topic.mu.Unlock()
+}
+
+// ****************************************************************************
+// Publish()
+// ****************************************************************************
+func (t *Topic[T]) Publish(value T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, h := range t.handlers {
+		handle := h.handle
+		select {
+		case h.subscriber.queue <- func() { handle(value) }:
+		default:
+			h.subscriber.dropped.Add(1)
+		}
+	}
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+// Handles the queued events, reporting the ones dropped since the last
+// handled event
+func (s *Subscriber) run() {
+	for handle := range s.queue {
+		if dropped := s.dropped.Load(); dropped > s.reported {
+			slog.Warn("events dropped, the subscriber is too slow",
+				"subscriber", s.Name, "dropped", dropped-s.reported, "total", dropped)
+			s.reported = dropped
+		}
+		handle()
+	}
+}
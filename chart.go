@@ -0,0 +1,203 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// LatencyChart draws the RTT of a target over a period, the lost probes
+// being red ticks at the bottom and the route changes orange lines
+type LatencyChart struct {
+	widget.BaseWidget
+	Span    time.Duration // Period shown, ending now
+	samples []Sample      // Oldest first
+	markers []time.Time
+}
+
+type latencyChartRenderer struct {
+	chart   *LatencyChart
+	bg      *canvas.Rectangle
+	top     *canvas.Text // Highest RTT of the scale
+	start   *canvas.Text // Time of the left edge
+	objects []fyne.CanvasObject
+}
+
+// ****************************************************************************
+// NewLatencyChart()
+// ****************************************************************************
+func NewLatencyChart(span time.Duration) *LatencyChart {
+	c := &LatencyChart{Span: span}
+	c.ExtendBaseWidget(c)
+	return c
+}
+
+// ****************************************************************************
+// SetSamples()
+// ****************************************************************************
+func (c *LatencyChart) SetSamples(samples []Sample) {
+	c.samples = samples
+	c.Refresh()
+}
+
+// ****************************************************************************
+// SetMarkers()
+// ****************************************************************************
+func (c *LatencyChart) SetMarkers(markers []time.Time) {
+	if slices.Equal(c.markers, markers) {
+		return
+	}
+	c.markers = markers
+	c.Refresh()
+}
+
+// ****************************************************************************
+// Append()
+// ****************************************************************************
+// Adds the samples newer than the last one drawn, forgetting those which
+// left the period
+func (c *LatencyChart) Append(samples []Sample) {
+	added := false
+	for _, s := range samples {
+		if len(c.samples) == 0 || s.Time.After(c.samples[len(c.samples)-1].Time) {
+			c.samples = append(c.samples, s)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	begin := time.Now().Add(-c.Span)
+	for len(c.samples) > 0 && c.samples[0].Time.Before(begin) {
+		c.samples = c.samples[1:]
+	}
+	c.Refresh()
+}
+
+// ****************************************************************************
+// CreateRenderer()
+// ****************************************************************************
+func (c *LatencyChart) CreateRenderer() fyne.WidgetRenderer {
+	r := &latencyChartRenderer{
+		chart: c,
+		bg:    canvas.NewRectangle(ColorLightGrey),
+		top:   canvas.NewText("", ColorDarkGrey),
+		start: canvas.NewText("", ColorDarkGrey),
+	}
+	r.top.TextSize = 10
+	r.start.TextSize = 10
+	return r
+}
+
+// ****************************************************************************
+// Layout()
+// ****************************************************************************
+// The samples are gathered in buckets of two pixels, the line joining the
+// average RTT of the buckets
+func (r *latencyChartRenderer) Layout(size fyne.Size) {
+	r.bg.Resize(size)
+	r.objects = []fyne.CanvasObject{r.bg}
+
+	end := time.Now()
+	begin := end.Add(-r.chart.Span)
+	buckets := max(int(size.Width/2), 1)
+	sums := make([]float64, buckets)
+	counts := make([]int, buckets)
+	lost := make([]bool, buckets)
+	highest := 1.0
+	for _, s := range r.chart.samples {
+		if s.Time.Before(begin) {
+			continue
+		}
+		idx := min(int(float64(s.Time.Sub(begin))/float64(r.chart.Span)*float64(buckets)), buckets-1)
+		if s.Lost {
+			lost[idx] = true
+			continue
+		}
+		sums[idx] += s.RTT
+		counts[idx]++
+		highest = max(highest, s.RTT)
+	}
+	highest *= 1.1 // Keeps the peaks off the top edge
+
+	x := func(idx int) float32 { return (float32(idx) + 0.5) * size.Width / float32(buckets) }
+	y := func(rtt float64) float32 { return size.Height * float32(1-rtt/highest) }
+	var previous *fyne.Position
+	for idx := range buckets {
+		if lost[idx] {
+			tick := canvas.NewLine(ColorRed)
+			tick.StrokeWidth = 2
+			tick.Position1 = fyne.NewPos(x(idx), size.Height-8)
+			tick.Position2 = fyne.NewPos(x(idx), size.Height)
+			r.objects = append(r.objects, tick)
+		}
+		if counts[idx] == 0 {
+			previous = nil // Gaps are not bridged
+			continue
+		}
+		point := fyne.NewPos(x(idx), y(sums[idx]/float64(counts[idx])))
+		if previous != nil {
+			segment := canvas.NewLine(ColorBlue)
+			segment.StrokeWidth = 1.5
+			segment.Position1, segment.Position2 = *previous, point
+			r.objects = append(r.objects, segment)
+		}
+		previous = &point
+	}
+	for _, marker := range r.chart.markers {
+		if marker.Before(begin) {
+			continue
+		}
+		left := size.Width * float32(marker.Sub(begin)) / float32(r.chart.Span)
+		line := canvas.NewLine(ColorOrange)
+		line.StrokeWidth = 1.5
+		line.Position1 = fyne.NewPos(left, 0)
+		line.Position2 = fyne.NewPos(left, size.Height)
+		r.objects = append(r.objects, line)
+	}
+
+	r.top.Text = fmt.Sprintf("%.1f ms", highest)
+	r.top.Move(fyne.NewPos(4, 2))
+	r.top.Resize(r.top.MinSize())
+	r.start.Text = begin.Format("01-02 15:04")
+	r.start.Move(fyne.NewPos(4, size.Height-r.start.MinSize().Height-10))
+	r.start.Resize(r.start.MinSize())
+	r.objects = append(r.objects, r.top, r.start)
+}
+
+// ****************************************************************************
+// MinSize()
+// ****************************************************************************
+func (r *latencyChartRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(200, 120)
+}
+
+// ****************************************************************************
+// Objects()
+// ****************************************************************************
+func (r *latencyChartRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+// ****************************************************************************
+// Destroy()
+// ****************************************************************************
+func (r *latencyChartRenderer) Destroy() {}
+
+// ****************************************************************************
+// Refresh()
+// ****************************************************************************
+func (r *latencyChartRenderer) Refresh() {
+	r.Layout(r.chart.Size())
+	canvas.Refresh(r.chart)
+}
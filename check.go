@@ -0,0 +1,219 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// CheckStatus follows the Nagios plugin exit codes
+type CheckStatus int
+
+const (
+	CheckOK CheckStatus = iota
+	CheckWarning
+	CheckCritical
+	CheckUnknown
+)
+
+// CheckThreshold is an average RTT and a loss percentage, as in "100,20%"
+type CheckThreshold struct {
+	RTT  float64 // Milliseconds
+	Loss float64 // Percent
+}
+
+type CheckResult struct {
+	Target   string      `json:"target"`
+	Address  string      `json:"address"`
+	Sent     int         `json:"sent"`
+	Received int         `json:"received"`
+	Loss     float64     `json:"loss"` // Percent
+	Min      float64     `json:"min"`
+	Average  float64     `json:"average"`
+	Max      float64     `json:"max"`
+	Status   CheckStatus `json:"-"`
+	State    string      `json:"status"`
+}
+
+// ****************************************************************************
+// String()
+// ****************************************************************************
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckOK:
+		return "OK"
+	case CheckWarning:
+		return "WARNING"
+	case CheckCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ****************************************************************************
+// runCheck()
+// ****************************************************************************
+// Implements "pingo check", returns the process exit code
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	count := flags.Int("count", 5, "probes sent to each target")
+	interval := flags.Float64("interval", 1, "seconds between two probes of a target")
+	warning := flags.String("w", "100,20%", "warning threshold, average RTT in ms and loss")
+	critical := flags.String("c", "500,60%", "critical threshold, average RTT in ms and loss")
+	format := flags.String("format", "text", "output format, text or json")
+	config := flags.String("config", "", "settings file, for the ping delimiter")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check [options] [name=]address ...\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Exit codes : 0 OK, 1 warning, 2 critical, 3 unknown.")
+		fmt.Fprintln(flags.Output(), "\nOptions:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return int(CheckUnknown)
+	}
+
+	warn, err := parseCheckThreshold(*warning)
+	if err != nil {
+		fmt.Printf("UNKNOWN - %v\n", err)
+		return int(CheckUnknown)
+	}
+	crit, err := parseCheckThreshold(*critical)
+	if err != nil {
+		fmt.Printf("UNKNOWN - %v\n", err)
+		return int(CheckUnknown)
+	}
+	if flags.NArg() == 0 || *count <= 0 {
+		flags.Usage()
+		return int(CheckUnknown)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Printf("UNKNOWN - unknown format %q, expected text or json\n", *format)
+		return int(CheckUnknown)
+	}
+	configPath = *config
+	settings, _ = loadSettings()
+
+	// Probe all the targets at the same time
+	targets := parseTargets(flags.Args())
+	results := make([]CheckResult, len(targets))
+	var wg sync.WaitGroup
+	for idx, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[idx] = checkTarget(target, *count, time.Duration(*interval*float64(time.Second)), warn, crit)
+		}()
+	}
+	wg.Wait()
+
+	status := CheckOK
+	for _, r := range results {
+		status = max(status, r.Status)
+	}
+	if *format == "json" {
+		data, _ := json.MarshalIndent(struct {
+			Status  string        `json:"status"`
+			Results []CheckResult `json:"results"`
+		}{status.String(), results}, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		writeCheckReport(os.Stdout, status, results, warn, crit)
+	}
+	return int(status)
+}
+
+// ****************************************************************************
+// parseCheckThreshold()
+// ****************************************************************************
+func parseCheckThreshold(value string) (CheckThreshold, error) {
+	rtt, loss, ok := strings.Cut(value, ",")
+	if !ok {
+		return CheckThreshold{}, fmt.Errorf("threshold %q is not in the form rta,loss%%", value)
+	}
+	var t CheckThreshold
+	var err error
+	if t.RTT, err = strconv.ParseFloat(rtt, 64); err != nil {
+		return t, fmt.Errorf("bad RTT in threshold %q", value)
+	}
+	if t.Loss, err = strconv.ParseFloat(strings.TrimSuffix(loss, "%"), 64); err != nil {
+		return t, fmt.Errorf("bad loss in threshold %q", value)
+	}
+	return t, nil
+}
+
+// ****************************************************************************
+// checkTarget()
+// ****************************************************************************
+func checkTarget(target TargetConfig, count int, interval time.Duration, warn, crit CheckThreshold) CheckResult {
+	r := CheckResult{Target: target.Name, Address: target.Address, Sent: count}
+	if r.Target == "" {
+		r.Target = target.Address
+	}
+	var sum float64
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		s := probeOnce(target.Address)
+		if s.Lost {
+			continue
+		}
+		r.Received++
+		sum += s.RTT
+		if r.Received == 1 || s.RTT < r.Min {
+			r.Min = s.RTT
+		}
+		r.Max = max(r.Max, s.RTT)
+	}
+	r.Loss = 100 * float64(count-r.Received) / float64(count)
+	if r.Received > 0 {
+		r.Average = sum / float64(r.Received)
+	}
+
+	switch {
+	case r.Received == 0, r.Loss >= crit.Loss, r.Average >= crit.RTT:
+		r.Status = CheckCritical
+	case r.Loss >= warn.Loss, r.Average >= warn.RTT:
+		r.Status = CheckWarning
+	default:
+		r.Status = CheckOK
+	}
+	r.State = r.Status.String()
+	return r
+}
+
+// ****************************************************************************
+// writeCheckReport()
+// ****************************************************************************
+// Writes the Nagios plugin output : a status line with the performance data,
+// then one line per target
+func writeCheckReport(out io.Writer, status CheckStatus, results []CheckResult, warn, crit CheckThreshold) {
+	var summary, perfdata []string
+	for _, r := range results {
+		summary = append(summary, fmt.Sprintf("%s rta %.3fms lost %.0f%%", r.Target, r.Average, r.Loss))
+		label := strings.NewReplacer(" ", "_", "'", "", "=", "_").Replace(r.Target)
+		perfdata = append(perfdata,
+			fmt.Sprintf("'%s_rta'=%.3fms;%g;%g;0", label, r.Average, warn.RTT, crit.RTT),
+			fmt.Sprintf("'%s_pl'=%.0f%%;%g;%g;0;100", label, r.Loss, warn.Loss, crit.Loss))
+	}
+	fmt.Fprintf(out, "PING %s - %s | %s\n", status, strings.Join(summary, ", "), strings.Join(perfdata, " "))
+
+	fmt.Fprintf(out, "%-24s %-18s %5s %5s %6s %9s %9s %9s  %s\n", "Hostname", "Address", "Sent", "Recv", "Lost", "Min", "Average", "Max", "Status")
+	for _, r := range results {
+		fmt.Fprintf(out, "%-24s %-18s %5d %5d %5.0f%% %9.1f %9.1f %9.1f  %s\n",
+			r.Target, r.Address, r.Sent, r.Received, r.Loss, r.Min, r.Average, r.Max, r.Status)
+	}
+}
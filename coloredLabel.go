@@ -162,6 +162,9 @@ func (r *coloredLabelRenderer) Destroy() {
 // SetText()
 // ****************************************************************************
 func (i *ColoredLabel) SetText(newText string) {
+	if i.text == newText {
+		return // Nothing to redraw
+	}
 	i.text = newText
 	i.Refresh() // This triggers r.Refresh() in the renderer
 }
@@ -170,6 +173,9 @@ func (i *ColoredLabel) SetText(newText string) {
 // SetColor()
 // ****************************************************************************
 func (i *ColoredLabel) SetColor(newColor color.Color) *ColoredLabel {
+	if i.color == newColor {
+		return i
+	}
 	i.color = newColor
 	i.Refresh() // This tells the renderer: "The data changed, redraw now!"
 	return i
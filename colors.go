@@ -6,7 +6,9 @@ var (
 	ColorGreen       = color.NRGBA{R: 76, G: 175, B: 80, A: 255}   // Green
 	ColorYellow      = color.NRGBA{R: 255, G: 235, B: 59, A: 255}  // Yellow
 	ColorRed         = color.NRGBA{R: 244, G: 67, B: 54, A: 255}   // Red
+	ColorOrange      = color.NRGBA{R: 255, G: 152, B: 0, A: 255}   // Orange
 	ColorDarkYellow  = color.NRGBA{R: 100, G: 100, B: 0, A: 255}   // Dark Yellow
+	ColorBlue        = color.NRGBA{R: 33, G: 150, B: 243, A: 255}  // Blue
 	ColorLightBlue   = color.NRGBA{R: 187, G: 222, B: 251, A: 255} // Soft Blue
 	ColorLightYellow = color.NRGBA{R: 255, G: 245, B: 157, A: 255} // Soft Yellow
 	ColorLightGrey   = color.NRGBA{R: 220, G: 227, B: 232, A: 255} // Light Grey
@@ -0,0 +1,407 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"cmp"
+	"fmt"
+	"image/color"
+	"net/netip"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// TableColumn describes a column of the targets table, key being the name
+// saved in the settings
+type TableColumn struct {
+	Key     string
+	Title   string
+	Width   float32                                                   // Default width
+	Cell    func(m *Monitor, stats TargetStats) (string, color.Color) // nil for the action buttons
+	Compare func(a, b tableRow) int                                   // nil when the column cannot be sorted
+}
+
+// ColumnSetting is a visible column as saved in the settings
+type ColumnSetting struct {
+	Key   string  `json:"key"`
+	Width float32 `json:"width"`
+}
+
+// columnLayout places the cells of a row, or the titles of the header with a
+// separator after each, at the widths of the visible columns
+type columnLayout struct {
+	separators bool
+}
+
+// columnSeparator is the handle dragged to resize the column on its left
+type columnSeparator struct {
+	widget.BaseWidget
+	index int // In shownColumns
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var tableColumns = []TableColumn{
+	{Key: "name", Title: "Hostname", Width: 140,
+		Cell: func(m *Monitor, _ TargetStats) (string, color.Color) { return m.Hostname(), ColorLightGrey },
+		Compare: func(a, b tableRow) int {
+			return cmp.Compare(strings.ToLower(a.hostname), strings.ToLower(b.hostname))
+		}},
+	{Key: "address", Title: "Address", Width: 120, Cell: addressCell, Compare: compareAddresses},
+	{Key: "lost", Title: "Lost", Width: 60,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%d", stats.Lost), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Lost, b.stats.Lost) }},
+	{Key: "loss", Title: "Loss %", Width: 60,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%.1f", stats.LossPercent()), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.LossPercent(), b.stats.LossPercent()) }},
+	{Key: "last", Title: "Ping", Width: 80, Cell: pingCell,
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Last, b.stats.Last) }},
+	{Key: "average", Title: "Average", Width: 70,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%.1f", stats.Average), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Average, b.stats.Average) }},
+	{Key: "min", Title: "Min", Width: 60,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%.1f", stats.Min), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Min, b.stats.Min) }},
+	{Key: "max", Title: "Max", Width: 60,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%.1f", stats.Max), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Max, b.stats.Max) }},
+	{Key: "jitter", Title: "Jitter", Width: 60,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%.1f", stats.Jitter), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Jitter, b.stats.Jitter) }},
+	{Key: "mos", Title: "MOS", Width: 50, Cell: mosCell,
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.MOS(), b.stats.MOS()) }},
+	{Key: "requests", Title: "Requests", Width: 70,
+		Cell: func(_ *Monitor, stats TargetStats) (string, color.Color) {
+			return fmt.Sprintf("%d", stats.Requests), ColorLightGrey
+		},
+		Compare: func(a, b tableRow) int { return cmp.Compare(a.stats.Requests, b.stats.Requests) }},
+	{Key: "action", Title: "Action", Width: 170},
+}
+
+// Columns shown until the user picks others
+var defaultColumns = []string{"name", "address", "lost", "last", "average", "min", "max", "requests", "action"}
+
+var shownColumns []ColumnSetting // Visible columns in their order, only used on the Fyne thread
+
+// ****************************************************************************
+// findColumn()
+// ****************************************************************************
+func findColumn(key string) (TableColumn, bool) {
+	for _, column := range tableColumns {
+		if column.Key == key {
+			return column, true
+		}
+	}
+	return TableColumn{}, false
+}
+
+// ****************************************************************************
+// compareAddresses()
+// ****************************************************************************
+// Orders the IP addresses numerically, before the host names
+func compareAddresses(a, b tableRow) int {
+	ipA, errA := netip.ParseAddr(a.monitor.Config.Address)
+	ipB, errB := netip.ParseAddr(b.monitor.Config.Address)
+	switch {
+	case errA == nil && errB == nil:
+		return ipA.Compare(ipB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return cmp.Compare(strings.ToLower(a.monitor.Config.Address), strings.ToLower(b.monitor.Config.Address))
+}
+
+// ****************************************************************************
+// addressCell()
+// ****************************************************************************
+// Muted targets keep probing but show their address in yellow
+func addressCell(m *Monitor, _ TargetStats) (string, color.Color) {
+	if isSilenced(m.Config.Address, time.Now()) {
+		return m.Config.Address, ColorLightYellow
+	}
+	return m.Config.Address, ColorLightBlue
+}
+
+// ****************************************************************************
+// pingCell()
+// ****************************************************************************
+func pingCell(m *Monitor, stats TargetStats) (string, color.Color) {
+	if m.Config.Paused {
+		return "paused", ColorDarkGrey
+	}
+	if stats.Flapping {
+		return "flapping", ColorOrange
+	}
+	text := fmt.Sprintf("%.1f", stats.Last)
+	switch stats.State {
+	case StateUp:
+		if stats.Anomaly {
+			return text, ColorYellow
+		}
+		return text, ColorGreen
+	case StateDown:
+		return text, ColorRed
+	case StateUnreachable:
+		return "parent down", ColorDarkYellow
+	default:
+		return text, ColorLightGrey
+	}
+}
+
+// ****************************************************************************
+// mosCell()
+// ****************************************************************************
+// Good from 4, poor under 3.1
+func mosCell(_ *Monitor, stats TargetStats) (string, color.Color) {
+	mos := stats.MOS()
+	switch {
+	case mos == 0:
+		return "-", ColorLightGrey
+	case mos >= 4:
+		return fmt.Sprintf("%.2f", mos), ColorGreen
+	case mos >= 3.1:
+		return fmt.Sprintf("%.2f", mos), ColorYellow
+	default:
+		return fmt.Sprintf("%.2f", mos), ColorRed
+	}
+}
+
+// ****************************************************************************
+// loadColumns()
+// ****************************************************************************
+// Reads the visible columns from the settings, the unknown ones being
+// ignored and the default ones used when none is left
+func loadColumns() {
+	shownColumns = nil
+	seen := make(map[string]bool)
+	for _, c := range settings.Columns {
+		column, ok := findColumn(c.Key)
+		if !ok || seen[c.Key] {
+			continue
+		}
+		seen[c.Key] = true
+		if c.Width < MinColumnWidth {
+			c.Width = column.Width
+		}
+		shownColumns = append(shownColumns, c)
+	}
+	if len(shownColumns) == 0 {
+		for _, key := range defaultColumns {
+			column, _ := findColumn(key)
+			shownColumns = append(shownColumns, ColumnSetting{Key: key, Width: column.Width})
+		}
+	}
+	columnsVersion++
+}
+
+// ****************************************************************************
+// applyColumns()
+// ****************************************************************************
+// Shows the columns in the header and the rows, and saves them
+func applyColumns(columns []ColumnSetting) {
+	updateSettings(func(s *AppSettings) {
+		s.Columns = append([]ColumnSetting(nil), columns...) // None for the defaults
+	})
+	loadColumns()
+	targetHeader.Update()
+	targetTable.Refresh()
+}
+
+// ****************************************************************************
+// Layout()
+// ****************************************************************************
+func (l *columnLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	step := 1
+	if l.separators {
+		step = 2
+	}
+	x := float32(0)
+	for idx, c := range shownColumns {
+		if (idx+1)*step > len(objects) {
+			return // Not rebuilt yet
+		}
+		cell := objects[idx*step]
+		cell.Move(fyne.NewPos(x+1, 0))
+		cell.Resize(fyne.NewSize(c.Width-2, size.Height))
+		if l.separators {
+			separator := objects[idx*step+1]
+			separator.Move(fyne.NewPos(x+c.Width-3, 0))
+			separator.Resize(fyne.NewSize(6, size.Height))
+		}
+		x += c.Width
+	}
+}
+
+// ****************************************************************************
+// MinSize()
+// ****************************************************************************
+// Only the height : columns wider than the panel are cut rather than making
+// the window grow
+func (l *columnLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	height := float32(0)
+	for _, o := range objects {
+		height = max(height, o.MinSize().Height)
+	}
+	return fyne.NewSize(0, height)
+}
+
+// ****************************************************************************
+// newColumnSeparator()
+// ****************************************************************************
+func newColumnSeparator(index int) *columnSeparator {
+	s := &columnSeparator{index: index}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+// ****************************************************************************
+// CreateRenderer()
+// ****************************************************************************
+func (s *columnSeparator) CreateRenderer() fyne.WidgetRenderer {
+	line := canvas.NewRectangle(ColorDarkGrey)
+	line.SetMinSize(fyne.NewSize(1, 0))
+	return widget.NewSimpleRenderer(container.NewCenter(line))
+}
+
+// ****************************************************************************
+// Cursor()
+// ****************************************************************************
+func (s *columnSeparator) Cursor() desktop.Cursor {
+	return desktop.HResizeCursor
+}
+
+// ****************************************************************************
+// Dragged()
+// ****************************************************************************
+func (s *columnSeparator) Dragged(ev *fyne.DragEvent) {
+	if s.index >= len(shownColumns) {
+		return
+	}
+	shownColumns[s.index].Width = max(MinColumnWidth, shownColumns[s.index].Width+ev.Dragged.DX)
+	columnsVersion++
+	targetHeader.Update()
+	targetTable.Refresh()
+}
+
+// ****************************************************************************
+// DragEnd()
+// ****************************************************************************
+func (s *columnSeparator) DragEnd() {
+	updateSettings(func(s *AppSettings) { s.Columns = append([]ColumnSetting(nil), shownColumns...) })
+}
+
+// ****************************************************************************
+// showColumnsDialog()
+// ****************************************************************************
+// Lets the user pick the visible columns and their order, the changes being
+// applied at once
+func showColumnsDialog(parentWin fyne.Window) {
+	// The visible columns first, in their order, then the hidden ones
+	var order []string
+	var visible map[string]bool
+	widths := make(map[string]float32)
+	load := func() {
+		order, visible = nil, make(map[string]bool)
+		for _, c := range shownColumns {
+			order = append(order, c.Key)
+			visible[c.Key] = true
+			widths[c.Key] = c.Width
+		}
+		for _, column := range tableColumns {
+			if !visible[column.Key] {
+				order = append(order, column.Key)
+				if widths[column.Key] == 0 {
+					widths[column.Key] = column.Width
+				}
+			}
+		}
+	}
+	load()
+
+	apply := func() {
+		var columns []ColumnSetting
+		for _, key := range order {
+			if visible[key] {
+				columns = append(columns, ColumnSetting{Key: key, Width: widths[key]})
+			}
+		}
+		if len(columns) > 0 {
+			applyColumns(columns)
+		}
+	}
+
+	list := container.NewVBox()
+	var refreshList func()
+	move := func(idx, delta int) {
+		if idx+delta < 0 || idx+delta >= len(order) {
+			return
+		}
+		order[idx], order[idx+delta] = order[idx+delta], order[idx]
+		apply()
+		refreshList()
+	}
+	refreshList = func() {
+		list.RemoveAll()
+		for idx, key := range order {
+			column, _ := findColumn(key)
+			check := widget.NewCheck(column.Title, nil)
+			check.SetChecked(visible[key])
+			check.OnChanged = func(checked bool) {
+				shown := 0
+				for _, v := range visible {
+					if v {
+						shown++
+					}
+				}
+				if !checked && shown == 1 {
+					check.SetChecked(true) // The last visible column stays
+					return
+				}
+				visible[key] = checked
+				apply()
+			}
+			list.Add(container.NewHBox(check, layout.NewSpacer(),
+				NewSlimButton("↑", func() { move(idx, -1) }),
+				NewSlimButton("↓", func() { move(idx, 1) })))
+		}
+	}
+	refreshList()
+
+	defaults := widget.NewButton("Defaults", func() {
+		applyColumns(nil)
+		load()
+		refreshList()
+	})
+
+	content := container.NewBorder(nil, defaults, nil, nil, container.NewVScroll(list))
+	d := dialog.NewCustom("Columns", "Close", content, parentWin)
+	d.Resize(fyne.NewSize(300, 480))
+	d.Show()
+}
@@ -4,13 +4,89 @@ package main
 // CONSTANTS
 // ****************************************************************************
 const (
-	AppID                = "fr.ozf.pingo"
-	AppTitle             = "Pingo"
-	AppFolderName        = ".pingo"
-	SettingsFileName     = "config.json"
-	GitRepository        = "https://api.github.com/repos/jplozf/pingo/commits/main"
-	StatusTimeout        = 3
-	StatusDefaultMessage = "Ready"
-	AppURL               = "https://github.com/jplozf/pingo"
-	Author               = "jpl@ozf.fr"
+	AppID                   = "fr.ozf.pingo"
+	AppTitle                = "Pingo"
+	AppFolderName           = ".pingo"
+	AppFolderMode           = 0700 // The app folder and its files are private to the user
+	AppFileMode             = 0600
+	SettingsFileName        = "config.json"
+	GitRepository           = "https://api.github.com/repos/jplozf/pingo/commits/main"
+	StatusTimeout           = 3
+	StatusDefaultMessage    = "Ready"
+	AppURL                  = "https://github.com/jplozf/pingo"
+	Author                  = "jpl@ozf.fr"
+	HistoryFolderName       = "history"
+	DefaultPingInterval     = 5 // Seconds between two probes of a target
+	DefaultPingDelimiter    = "time="
+	DownAfterLost           = 3    // Consecutive lost probes before a target is down
+	SamplesKept             = 1000 // Samples kept in memory per target
+	SilenceDuration         = 1    // Hours muted by the row "Mute" button
+	MaxDependencyDepth      = 32   // Longest parent chain followed before assuming a loop
+	FlapWindow              = 21   // Probes considered by the flap score
+	FlapHighThreshold       = 30.0 // Flap score (%) above which a target starts flapping
+	FlapLowThreshold        = 15.0 // Flap score (%) below which it stops flapping
+	BaselinesFileName       = "baselines.json"
+	BaselineAlpha           = 0.125 // EWMA gain of the mean RTT
+	BaselineBeta            = 0.25  // EWMA gain of the RTT deviation
+	BaselineWarmup          = 30    // Samples learned before a baseline is trusted
+	BaselineMinDeviation    = 0.5   // Milliseconds, keeps quiet LAN links from alerting on noise
+	DefaultAnomalySigmas    = 4.0
+	AnomalyAfter            = 3 // Anomalous samples in a row before raising an anomaly
+	ProbeTypeICMP           = "icmp"
+	DefaultMetricsAddr      = "127.0.0.1"
+	DefaultMetricsPort      = 9123
+	DefaultAPIAddr          = "127.0.0.1"
+	DefaultAPIPort          = 9124
+	DefaultWebAddr          = "127.0.0.1"
+	DefaultWebPort          = 9125
+	IncidentsFileName       = "incidents.jsonl"
+	IncidentsKept           = 500    // Incidents kept in memory
+	DefaultSinkBatch        = 500    // Lines per write to an output
+	DefaultSinkFlush        = 10     // Seconds between two writes to an output
+	DefaultSinkBuffer       = 100000 // Lines kept while an output is unreachable
+	SinkTimeout             = 10     // Seconds before giving up on a write
+	SinkStopTimeout         = 5      // Seconds given to the outputs to write their pending lines on exit
+	InfluxUDPPayload        = 1400   // Bytes per datagram, below the usual MTU
+	DefaultInfluxTemplate   = "pingo"
+	DefaultGraphiteTemplate = "pingo.{group}.{name}"
+	DefaultMQTTStatusTopic  = "pingo/{address}/status"
+	DefaultMQTTSampleTopic  = "pingo/{address}/sample"
+	DefaultMQTTWillTopic    = "pingo/availability"
+	MQTTQueue               = 10000 // Messages kept while the broker is unreachable
+	MQTTInflight            = 1000  // QoS 1 messages sent and waiting for their PUBACK
+	MQTTSessionExpiry       = 3600  // Seconds the MQTT 5 broker keeps the session after a disconnection
+	MQTTKeepAlive           = 60    // Seconds
+	MQTTTimeout             = 10    // Seconds before giving up on the broker
+	MQTTRetry               = 10    // Seconds between two connection attempts
+	DefaultOTLPHTTPEndpoint = "http://localhost:4318"
+	DefaultOTLPGRPCEndpoint = "http://localhost:4317"
+	DefaultOTLPInterval     = 60    // Seconds between two OTLP exports
+	OTLPTimeout             = 10    // Seconds before giving up on the collector
+	StreamBuffer            = 256   // Events queued per streaming client before dropping
+	StreamKeepAlive         = 15    // Seconds between two SSE keep-alive comments
+	StreamWriteTimeout      = 10    // Seconds before giving up on a stalled WebSocket client
+	StreamMaxFrame          = 65536 // Largest WebSocket frame accepted from a client
+	StatusHistoryKept       = 500   // Status bar messages kept for the history panel
+	BusBuffer               = 4096  // Events queued per bus subscriber before dropping
+	MinColumnWidth          = 30    // Narrowest a column of the targets table can be dragged
+	TracerouteTimeout       = 60    // Seconds before a traceroute round is abandoned
+	TraceMaxHops            = 30    // Hops tried before giving up on the destination
+	TraceWait               = 1     // Seconds waited for the answer of a hop
+	TraceInterval           = 1     // Seconds between two rounds of the traceroute view
+	TraceLossWarning        = 50.0  // Loss (%) of a hop shown in red from there
+	DetailSamplesShown      = 100   // Last samples listed in the detail pane
+	DetailChartHours        = 24    // Hours of history in the chart of the detail pane
+	UIFrameRate             = 10    // Redraws per second of the targets table at most
+	TerminalRefresh         = 500   // Milliseconds between two redraws of the terminal dashboard
+	TerminalReservedRows    = 6     // Lines of the terminal dashboard around the targets : title, header, message and keys
+	RoutesFileName          = "routes.json"
+	DefaultRouteInterval    = 30 // Minutes between two traceroutes of a target detecting route changes
+	RouteCheckPeriod        = 60 // Seconds between two looks for routes to trace
+	TTLChangeAfter          = 3  // Replies with a new TTL in a row before reporting a route change
+	LogFileName             = "pingo.log"
+	LogMaxSize              = 5 << 20 // Bytes before the log file is rotated
+	LogFilesKept            = 5       // Rotated log files kept
+	LogTimeout              = 5       // Seconds before giving up on the syslog server
+	LogQueueSize            = 1000    // Records waiting for the syslog server
+	DefaultSyslogFacility   = 16      // local0
 )
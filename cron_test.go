@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TestParseCron()
+// ****************************************************************************
+func TestParseCron(t *testing.T) {
+	valid := []string{"* * * * *", "0 2 * * 0", "*/15 8-18 * * 1-5", "5/15 * 1,15 * *", "0 0 * * 7"}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) : %v", expr, err)
+		}
+	}
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "a * * * *", "5-2 * * * *"}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) accepted", expr)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestCronMatches()
+// ****************************************************************************
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   string
+		want bool
+	}{
+		{"0 2 * * 0", "2026-10-18 02:00", true}, // Sunday
+		{"0 2 * * 7", "2026-10-18 02:00", true},
+		{"0 2 * * 0", "2026-10-18 02:01", false},
+		{"0 2 * * 0", "2026-10-17 02:00", false},
+		{"*/15 8-18 * * 1-5", "2026-10-19 08:45", true},
+		{"*/15 8-18 * * 1-5", "2026-10-19 08:46", false},
+		{"*/15 8-18 * * 1-5", "2026-10-19 19:00", false},
+		{"5/15 * * * *", "2026-10-19 10:50", true},
+		{"5/15 * * * *", "2026-10-19 10:00", false},
+		{"0 0 1 * 0", "2026-10-01 00:00", true}, // Both days restricted, either one
+		{"0 0 1 * 0", "2026-10-04 00:00", true},
+		{"0 0 1 * 0", "2026-10-03 00:00", false},
+		{"0 0 1 * */2", "2026-10-01 00:00", true}, // "*/2" is a wildcard, both must match
+		{"0 0 1 * */2", "2026-07-01 00:00", false},
+		{"0 0 1 * */2", "2026-10-03 00:00", false},
+		{"0 0 */2 * 1", "2026-10-26 00:00", false}, // A Monday, but an even day
+		{"0 0 * 2 *", "2026-10-19 00:00", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) : %v", tt.expr, err)
+		}
+		at, _ := time.ParseInLocation("2006-01-02 15:04", tt.at, time.Local)
+		if got := c.Matches(at); got != tt.want {
+			t.Errorf("%q at %s = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestCronPrevious()
+// ****************************************************************************
+func TestCronPrevious(t *testing.T) {
+	parse := func(value string) time.Time {
+		at, _ := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		return at
+	}
+	tests := []struct {
+		expr  string
+		at    string
+		since string
+		want  string // Empty when none
+	}{
+		{"0 2 * * 0", "2026-10-19 10:30", "2026-10-01 00:00", "2026-10-18 02:00"},
+		{"0 2 * * 0", "2026-10-18 02:00", "2026-10-18 00:00", "2026-10-18 02:00"},
+		{"0 2 * * 0", "2026-10-18 01:59", "2026-10-12 00:00", ""},
+		{"*/20 9 * * *", "2026-10-19 09:59", "2026-10-19 00:00", "2026-10-19 09:40"},
+		{"*/20 9 * * *", "2026-10-19 10:10", "2026-10-19 00:00", "2026-10-19 09:40"},
+		{"30 * * * *", "2026-10-19 10:10", "2026-10-19 10:00", ""},
+		{"0 0 29 2 *", "2026-10-19 00:00", "2023-01-01 00:00", "2024-02-29 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) : %v", tt.expr, err)
+		}
+		got, ok := c.Previous(parse(tt.at), parse(tt.since))
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%q before %s = %s, want none", tt.expr, tt.at, got)
+		case tt.want != "" && (!ok || !got.Equal(parse(tt.want))):
+			t.Errorf("%q before %s = %s %v, want %s", tt.expr, tt.at, got, ok, tt.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestMaintenanceWindowActiveAt()
+// ****************************************************************************
+func TestMaintenanceWindowActiveAt(t *testing.T) {
+	mw, err := NewMaintenanceWindow("", "0 2 * * 0", 120, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{"2026-10-18 01:59", false},
+		{"2026-10-18 02:00", true},
+		{"2026-10-18 03:59", true},
+		{"2026-10-18 04:00", false},
+		{"2026-10-19 02:30", false},
+	}
+	for _, tt := range tests {
+		at, _ := time.ParseInLocation("2006-01-02 15:04", tt.at, time.Local)
+		if got := mw.ActiveAt(at); got != tt.want {
+			t.Errorf("ActiveAt(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	if (MaintenanceWindow{Schedule: "0 2 * * 0", Duration: 120}).ActiveAt(time.Now()) {
+		t.Error("a window whose schedule was not parsed is active")
+	}
+}
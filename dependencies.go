@@ -0,0 +1,97 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var navTree *widget.Tree
+var navChildren map[string][]string // Rebuilt at each refresh of navTree
+
+// ****************************************************************************
+// newDependencyTree()
+// ****************************************************************************
+// Builds the navigation tree where each target is listed under its parent
+func newDependencyTree() *widget.Tree {
+	navChildren = dependencyChildren(engine.Monitors())
+	tree := widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID {
+			return navChildren[uid]
+		},
+		func(uid widget.TreeNodeID) bool {
+			return uid == "" || len(navChildren[uid]) > 0
+		},
+		func(branch bool) fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(uid widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
+			m := engine.Find(uid)
+			if m == nil {
+				return
+			}
+			state := m.Stats().State.String()
+			if m.Config.Paused {
+				state = "paused"
+			}
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s (%s)", m.DisplayName(), state))
+		},
+	)
+	tree.OnSelected = func(uid widget.TreeNodeID) {
+		if m := engine.Find(uid); m != nil {
+			showTargetDetail(m)
+		}
+	}
+	tree.OpenAllBranches()
+	return tree
+}
+
+// ****************************************************************************
+// dependencyChildren()
+// ****************************************************************************
+// Returns the addresses of the targets depending on each target, "" being
+// the root. The parents are resolved as Engine.Parent does, from one map.
+func dependencyChildren(monitors []*Monitor) map[string][]string {
+	byAddress := make(map[string]*Monitor, len(monitors))
+	for _, m := range monitors {
+		byAddress[m.Config.Address] = m
+	}
+	children := make(map[string][]string)
+	for _, m := range monitors {
+		parent := byAddress[m.Config.Parent]
+		for p, hops := parent, 0; p != nil && hops < MaxDependencyDepth; hops++ {
+			if p == m {
+				parent = nil // Cycle
+				break
+			}
+			p = byAddress[p.Config.Parent]
+		}
+		if parent == nil {
+			children[""] = append(children[""], m.Config.Address)
+		} else {
+			children[parent.Config.Address] = append(children[parent.Config.Address], m.Config.Address)
+		}
+	}
+	return children
+}
+
+// ****************************************************************************
+// refreshDependencyTree()
+// ****************************************************************************
+func refreshDependencyTree() {
+	if navTree == nil {
+		return
+	}
+	fyne.Do(func() {
+		navChildren = dependencyChildren(engine.Monitors())
+		navTree.OpenAllBranches()
+		navTree.Refresh()
+	})
+}
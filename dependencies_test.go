@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// ****************************************************************************
+// TestDependencyChildren()
+// ****************************************************************************
+func TestDependencyChildren(t *testing.T) {
+	e := NewEngine(0)
+	e.Add(TargetConfig{Address: "gw"})
+	e.Add(TargetConfig{Address: "dns", Parent: "gw"})
+	e.Add(TargetConfig{Address: "web", Parent: "dns"})
+	e.Add(TargetConfig{Address: "orphan", Parent: "missing"})
+	e.Add(TargetConfig{Address: "a", Parent: "b"}) // Cycle, both at the root
+	e.Add(TargetConfig{Address: "b", Parent: "a"})
+
+	children := dependencyChildren(e.Monitors())
+	want := map[string][]string{
+		"":    {"gw", "orphan", "a", "b"},
+		"gw":  {"dns"},
+		"dns": {"web"},
+	}
+	if len(children) != len(want) {
+		t.Fatalf("children = %v, want %v", children, want)
+	}
+	for parent, addresses := range want {
+		if !slices.Equal(children[parent], addresses) {
+			t.Errorf("children of %q = %v, want %v", parent, children[parent], addresses)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// TargetDetail is the pane below the table showing everything about the
+// target of the last clicked row
+type TargetDetail struct {
+	monitor       *Monitor // nil until a row is clicked
+	title         *widget.Label
+	values        map[string]*widget.Label
+	names         string // Resolved by resolveNames()
+	addresses     string
+	chart         *LatencyChart
+	samples       []Sample // Newest first
+	incidents     []Event  // Newest first
+	samplesList   *widget.List
+	incidentsList *widget.List
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var targetDetail *TargetDetail
+
+// Fields of the overview, statistics then target
+var detailStatsFields = []string{"State", "Last", "Average", "Min / Max", "Jitter", "Lost", "MOS", "Flap score", "Baseline", "Deviation"}
+var detailTargetFields = []string{"Name", "Reverse names", "Addresses", "Probe", "Interval", "Parent", "Group", "Tags", "Alerts"}
+
+// ****************************************************************************
+// createDetailPane()
+// ****************************************************************************
+func createDetailPane() fyne.CanvasObject {
+	d := &TargetDetail{
+		title:  widget.NewLabel("Click a target to show its details"),
+		values: make(map[string]*widget.Label),
+		chart:  NewLatencyChart(DetailChartHours * time.Hour),
+	}
+	d.title.TextStyle = fyne.TextStyle{Bold: true}
+	targetDetail = d
+
+	form := func(fields []string) *fyne.Container {
+		c := container.New(layout.NewFormLayout())
+		for _, field := range fields {
+			key := widget.NewLabel(field)
+			key.TextStyle = fyne.TextStyle{Bold: true}
+			d.values[field] = widget.NewLabel("-")
+			d.values[field].Truncation = fyne.TextTruncateEllipsis
+			c.Add(key)
+			c.Add(d.values[field])
+		}
+		return c
+	}
+	overview := container.NewGridWithColumns(2, form(detailStatsFields), form(detailTargetFields))
+
+	d.samplesList = widget.NewList(
+		func() int { return len(d.samples) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			s := d.samples[id]
+			text := fmt.Sprintf("%s  %.1f ms", s.Time.Format("15:04:05"), s.RTT)
+			if s.Lost {
+				text = s.Time.Format("15:04:05") + "  lost"
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	d.incidentsList = widget.NewList(
+		func() int { return len(d.incidents) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			ev := d.incidents[id]
+			item.(*widget.Label).SetText(fmt.Sprintf("%s  %s", ev.Time.Format("2006-01-02 15:04:05"), ev.Message))
+		},
+	)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Overview", container.NewVScroll(overview)),
+		container.NewTabItem("Chart", d.chart),
+		container.NewTabItem(fmt.Sprintf("Last %d Samples", DetailSamplesShown), d.samplesList),
+		container.NewTabItem("Incidents", d.incidentsList),
+	)
+	return container.NewBorder(d.title, nil, nil, nil, tabs)
+}
+
+// ****************************************************************************
+// showTargetDetail()
+// ****************************************************************************
+// Shows a target in the detail pane, must be called on the Fyne thread
+func showTargetDetail(m *Monitor) {
+	d := targetDetail
+	if d == nil {
+		return
+	}
+	if d.monitor != nil && d.monitor.Config.Address == m.Config.Address {
+		d.monitor = m
+		d.refresh()
+		return
+	}
+
+	d.monitor = m
+	d.names, d.addresses = "resolving...", "resolving..."
+	d.chart.SetSamples(nil)
+	address := m.Config.Address
+	go func() {
+		history, _ := loadHistory(address, time.Now().Add(-DetailChartHours*time.Hour))
+		fyne.Do(func() {
+			if d.monitor != nil && d.monitor.Config.Address == address {
+				d.chart.SetSamples(history)
+				d.chart.Append(d.monitor.Samples())
+			}
+		})
+	}()
+	go func() {
+		names, addresses := resolveNames(address)
+		fyne.Do(func() {
+			if d.monitor != nil && d.monitor.Config.Address == address {
+				d.names, d.addresses = names, addresses
+				d.refresh()
+			}
+		})
+	}()
+	d.refresh()
+	targetTable.Refresh() // Moves the bold row
+}
+
+// ****************************************************************************
+// detailAddress()
+// ****************************************************************************
+// Returns the address of the target in the detail pane, empty when none
+func detailAddress() string {
+	if targetDetail == nil || targetDetail.monitor == nil {
+		return ""
+	}
+	return targetDetail.monitor.Config.Address
+}
+
+// ****************************************************************************
+// refreshDetail()
+// ****************************************************************************
+// Called at each frame of the table, must be called on the Fyne thread
+func refreshDetail() {
+	if targetDetail != nil {
+		targetDetail.refresh()
+	}
+}
+
+// ****************************************************************************
+// refresh()
+// ****************************************************************************
+func (d *TargetDetail) refresh() {
+	if d.monitor == nil {
+		return
+	}
+	// The monitor is replaced when its target is modified
+	m := engine.Find(d.monitor.Config.Address)
+	if m == nil {
+		d.title.SetText(d.monitor.DisplayName() + " is no longer monitored")
+		return
+	}
+	d.monitor = m
+	stats := m.Stats()
+	baseline := m.Baseline()
+	reference := baseline.reference(time.Now(), settings.BaselinePerHour)
+
+	state := stats.State.String()
+	if m.Config.Paused {
+		state = "paused"
+	}
+	values := map[string]string{
+		"State":      state,
+		"Last":       fmt.Sprintf("%.1f ms", stats.Last),
+		"Average":    fmt.Sprintf("%.1f ms", stats.Average),
+		"Min / Max":  fmt.Sprintf("%.1f / %.1f ms", stats.Min, stats.Max),
+		"Jitter":     fmt.Sprintf("%.1f ms", stats.Jitter),
+		"Lost":       fmt.Sprintf("%d of %d (%.1f %%)", stats.Lost, stats.Requests, stats.LossPercent()),
+		"MOS":        fmt.Sprintf("%.2f", stats.MOS()),
+		"Flap score": fmt.Sprintf("%.0f %%", stats.FlapScore),
+		"Baseline":   "learning",
+		"Deviation":  fmt.Sprintf("%.1f sigmas", stats.Sigmas),
+
+		"Name":          m.Hostname(),
+		"Reverse names": d.names,
+		"Addresses":     d.addresses,
+		"Probe":         probeDescription(m.Config.Address),
+		"Interval":      engine.Interval.String(),
+		"Parent":        m.Config.Parent,
+		"Group":         m.Config.Group,
+		"Tags":          strings.Join(m.Config.Tags, ", "),
+		"Alerts":        "active",
+	}
+	if reference.Count >= BaselineWarmup {
+		values["Baseline"] = fmt.Sprintf("%.1f ± %.1f ms", reference.Mean, reference.Dev)
+	}
+	if until, ok := silencedUntil(m.Config.Address); ok {
+		values["Alerts"] = "muted until " + until.Format("15:04")
+	} else if isSilenced(m.Config.Address, time.Now()) {
+		values["Alerts"] = "maintenance window"
+	}
+	for field, label := range d.values {
+		text := values[field]
+		if text == "" {
+			text = "-"
+		}
+		label.SetText(text)
+	}
+	d.title.SetText(fmt.Sprintf("%s (%s)", m.DisplayName(), m.Config.Address))
+
+	samples := m.Samples()
+	d.chart.Append(samples)
+	samples = samples[max(len(samples)-DetailSamplesShown, 0):]
+	slices.Reverse(samples)
+	d.samples = samples
+	d.samplesList.Refresh()
+
+	d.incidents = Incidents(m.Config.Address)
+	slices.Reverse(d.incidents)
+	d.incidentsList.Refresh()
+
+	var markers []time.Time
+	for _, ev := range d.incidents {
+		if ev.Type == "route" {
+			markers = append(markers, ev.Time)
+		}
+	}
+	d.chart.SetMarkers(markers)
+}
+
+// ****************************************************************************
+// probeDescription()
+// ****************************************************************************
+func probeDescription(address string) string {
+	if runtime.GOOS == "windows" {
+		return "ICMP echo, ping -n 1 " + address
+	}
+	return "ICMP echo, ping -c 1 " + address
+}
+
+// ****************************************************************************
+// resolveNames()
+// ****************************************************************************
+// Returns the names the addresses of a target resolve to, and its addresses
+// when it is given by name
+func resolveNames(address string) (string, string) {
+	addresses, err := net.LookupHost(address)
+	if err != nil {
+		return "-", err.Error()
+	}
+	var names []string
+	for _, ip := range addresses {
+		found, _ := net.LookupAddr(ip)
+		for _, name := range found {
+			name = strings.TrimSuffix(name, ".")
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	return strings.Join(names, ", "), strings.Join(addresses, ", ")
+}
@@ -0,0 +1,40 @@
+package main
+
+// ****************************************************************************
+// updateFlapping()
+// ****************************************************************************
+// Computes the flap score the same way Nagios does : the state changes seen
+// over the last FlapWindow probes, recent changes weighing more than old ones.
+// Must be called with m.mu held, returns true when the flapping flag changed.
+func (m *Monitor) updateFlapping() bool {
+	if m.stats.State == StateUnknown {
+		return false // Still waiting for enough lost probes to decide
+	}
+	m.upHistory = append(m.upHistory, m.stats.State == StateUp)
+	if len(m.upHistory) > FlapWindow {
+		m.upHistory = m.upHistory[len(m.upHistory)-FlapWindow:]
+	}
+
+	n := len(m.upHistory)
+	if n < 2 {
+		return false
+	}
+	// Weights go linearly from 0.8 for the oldest change to 1.2 for the newest,
+	// and average 1 over a full window so a short history can't look flappy
+	offset := FlapWindow - n
+	var changes float64
+	for idx := 1; idx < n; idx++ {
+		if m.upHistory[idx] != m.upHistory[idx-1] {
+			changes += 0.8 + 0.4*float64(offset+idx-1)/float64(FlapWindow-2)
+		}
+	}
+	m.stats.FlapScore = 100 * changes / float64(FlapWindow-1)
+
+	wasFlapping := m.stats.Flapping
+	if m.stats.FlapScore >= FlapHighThreshold {
+		m.stats.Flapping = true
+	} else if m.stats.FlapScore < FlapLowThreshold {
+		m.stats.Flapping = false
+	}
+	return wasFlapping != m.stats.Flapping
+}
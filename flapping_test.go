@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// probeStates()
+// ****************************************************************************
+// Runs the flap detection after each state, returning the probes where the
+// flapping flag changed
+func probeStates(m *Monitor, states ...TargetState) []int {
+	var changed []int
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, state := range states {
+		m.stats.State = state
+		if m.updateFlapping() {
+			changed = append(changed, idx)
+		}
+	}
+	return changed
+}
+
+// ****************************************************************************
+// repeatState()
+// ****************************************************************************
+func repeatState(state TargetState, n int) []TargetState {
+	states := make([]TargetState, n)
+	for idx := range states {
+		states[idx] = state
+	}
+	return states
+}
+
+// ****************************************************************************
+// TestFlapScore()
+// ****************************************************************************
+// Changes weigh from 0.8 for the oldest to 1.2 for the newest, over the 20
+// transitions of a full window
+func TestFlapScore(t *testing.T) {
+	alternate := make([]TargetState, FlapWindow)
+	for idx := range alternate {
+		alternate[idx] = StateUp
+		if idx%2 == 1 {
+			alternate[idx] = StateDown
+		}
+	}
+	for _, c := range []struct {
+		name   string
+		states []TargetState
+		want   float64
+	}{
+		{"steady", repeatState(StateUp, FlapWindow), 0},
+		{"unknown ignored", append(repeatState(StateUnknown, 5), StateUp), 0},
+		{"short history", []TargetState{StateUp, StateDown}, 6},
+		{"newest change", append(repeatState(StateUp, FlapWindow-1), StateDown), 6},
+		{"oldest change", append([]TargetState{StateDown}, repeatState(StateUp, FlapWindow-1)...), 4},
+		{"window slides", append([]TargetState{StateDown}, repeatState(StateUp, FlapWindow)...), 0},
+		{"always changing", alternate, 100},
+	} {
+		m := NewEngine(time.Second).Add(TargetConfig{Address: "192.0.2.1"})
+		probeStates(m, c.states...)
+		if math.Abs(m.stats.FlapScore-c.want) > 1e-9 {
+			t.Errorf("%s : score %v, want %v", c.name, m.stats.FlapScore, c.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestFlapHysteresis()
+// ****************************************************************************
+// Flapping starts at FlapHighThreshold and only stops below
+// FlapLowThreshold, the scores in between keeping the current flag
+func TestFlapHysteresis(t *testing.T) {
+	m := NewEngine(time.Second).Add(TargetConfig{Address: "192.0.2.1"})
+	probeStates(m, repeatState(StateUp, FlapWindow)...)
+
+	state, between, started := StateUp, 0, false
+	for probe := range 3 * FlapWindow {
+		// Changes at every probe, then steady
+		if probe < 8 && state == StateUp {
+			state = StateDown
+		} else if probe < 8 {
+			state = StateUp
+		}
+		wasFlapping := m.stats.Flapping
+		changed := len(probeStates(m, state)) > 0
+		score, flapping := m.stats.FlapScore, m.stats.Flapping
+
+		switch {
+		case score >= FlapHighThreshold && !flapping:
+			t.Fatalf("probe %d : score %.1f without flapping", probe, score)
+		case score < FlapLowThreshold && flapping:
+			t.Fatalf("probe %d : score %.1f still flapping", probe, score)
+		case score >= FlapLowThreshold && score < FlapHighThreshold:
+			if flapping != wasFlapping {
+				t.Fatalf("probe %d : flag changed at score %.1f", probe, score)
+			}
+			between++
+		}
+		started = started || flapping
+		if changed != (flapping != wasFlapping) {
+			t.Fatalf("probe %d : change reported %v, flag %v -> %v", probe, changed, wasFlapping, flapping)
+		}
+	}
+	if m.stats.Flapping || m.stats.FlapScore != 0 {
+		t.Errorf("steady again, score %.1f, flapping %v", m.stats.FlapScore, m.stats.Flapping)
+	}
+	if !started || between == 0 {
+		t.Errorf("flapping %v, %d scores between the thresholds", started, between)
+	}
+}
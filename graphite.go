@@ -0,0 +1,52 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ****************************************************************************
+// graphiteLines()
+// ****************************************************************************
+// Encodes a sample in the plaintext protocol, one line per metric :
+// <path>.rtt 12.3 1700000000 and <path>.lost 0 1700000000
+func graphiteLines(path string, s Sample) []string {
+	timestamp := s.Time.Unix()
+	if s.Lost {
+		return []string{fmt.Sprintf("%s.lost 1 %d", path, timestamp)}
+	}
+	return []string{
+		fmt.Sprintf("%s.rtt %s %d", path, strconv.FormatFloat(s.RTT, 'f', -1, 64), timestamp),
+		fmt.Sprintf("%s.lost 0 %d", path, timestamp),
+	}
+}
+
+// ****************************************************************************
+// graphiteWriter()
+// ****************************************************************************
+// Writes the lines over a connection kept open between batches, and opened
+// again at the next batch once broken
+func graphiteWriter(host string) func(lines []string) error {
+	var conn net.Conn
+	return func(lines []string) error {
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout("tcp", host, SinkTimeout*time.Second); err != nil {
+				return err
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(SinkTimeout * time.Second))
+		if _, err := conn.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+			conn.Close()
+			conn = nil
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+type Options struct {
+	Headless   bool
+	Terminal   bool
+	ConfigPath string
+	Interval   int    // Seconds, 0 keeps the configured one
+	Format     string // "text" or "json"
+	Samples    bool   // Also write every probe result
+	Targets    []string
+}
+
+// Event is one line of the headless output
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"` // "sample", "state", "flapping", "anomaly" or "route"
+	Target   string    `json:"target"`
+	Address  string    `json:"address"`
+	Group    string    `json:"group,omitempty"`
+	State    string    `json:"state"`
+	RTT      float64   `json:"rtt,omitempty"`
+	Lost     bool      `json:"lost,omitempty"`
+	Silenced bool      `json:"silenced,omitempty"`
+	Message  string    `json:"message"`
+	Route    []string  `json:"route,omitempty"` // Hops of a new route, "*" when silent
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var eventLog = log.New(os.Stdout, "", 0)
+
+// ****************************************************************************
+// parseOptions()
+// ****************************************************************************
+func parseOptions() Options {
+	var opts Options
+	flag.BoolVar(&opts.Headless, "headless", false, "run without window, writing events to stdout")
+	flag.BoolVar(&opts.Terminal, "tui", false, "run the dashboard in the terminal, e.g. over SSH")
+	flag.StringVar(&opts.ConfigPath, "config", "", "settings file (default ~/"+AppFolderName+"/"+SettingsFileName+")")
+	flag.IntVar(&opts.Interval, "interval", 0, "seconds between two probes of a target (headless, tui)")
+	flag.StringVar(&opts.Format, "format", "text", "event output format, text or json (headless)")
+	flag.BoolVar(&opts.Samples, "samples", false, "also write every probe result (headless)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [[name=]address ...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s check [options] [name=]address ...\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Targets given on the command line replace the configured ones in headless mode.")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nOptions:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	opts.Targets = flag.Args()
+	return opts
+}
+
+// ****************************************************************************
+// runHeadless()
+// ****************************************************************************
+// Monitors the targets without any window until interrupted, returns the
+// process exit code
+func runHeadless(opts Options) int {
+	if opts.Format != "text" && opts.Format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text or json\n", opts.Format)
+		return 2
+	}
+
+	var err error
+	settings, err = loadSettings()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "cannot read settings : %v\n", err)
+		return 1
+	}
+	if err := startLogging(settings, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if opts.Interval > 0 {
+		settings.PingInterval = opts.Interval
+	}
+	// Targets given on the command line are monitored instead of the configured ones
+	targetsFromCommandLine = len(opts.Targets) > 0
+	engine = newEngineFromSettings(parseTargets(opts.Targets))
+	console := bus.Subscribe("console")
+	On(console, &bus.States, func(c StateChange) {
+		ev := newEvent("state", c.Monitor, stateMessage(c.Monitor, c.To))
+		ev.State = c.To.String()
+		writeEvent(opts.Format, ev)
+	})
+	On(console, &bus.Flaps, func(c FlapChange) {
+		writeEvent(opts.Format, newEvent("flapping", c.Monitor, flapMessage(c.Monitor, c.Flapping)))
+	})
+	On(console, &bus.Anomalies, func(c AnomalyChange) {
+		writeEvent(opts.Format, newEvent("anomaly", c.Monitor, anomalyMessage(c.Monitor, c.Anomaly)))
+	})
+	On(console, &bus.Routes, func(c RouteChange) {
+		ev := newEvent("route", c.Monitor, routeMessage(c))
+		ev.Route = c.New
+		writeEvent(opts.Format, ev)
+	})
+	if opts.Samples {
+		On(console, &bus.Samples, func(r ProbeResult) {
+			ev := newEvent("sample", r.Monitor, "")
+			ev.Time, ev.RTT, ev.Lost = r.Sample.Time, r.Sample.RTT, r.Sample.Lost
+			writeEvent(opts.Format, ev)
+		})
+	}
+
+	startServices(engine) // Failures are logged, the probing goes on
+	engine.StartAll()
+
+	// Run until Ctrl-C or a service manager stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	for _, m := range engine.Monitors() {
+		m.Stop()
+	}
+	saveBaselines(engine)
+	stopServices()
+	return 0
+}
+
+// ****************************************************************************
+// parseTargets()
+// ****************************************************************************
+// Turns "address" or "name=address" arguments into targets
+func parseTargets(args []string) []TargetConfig {
+	var targets []TargetConfig
+	for _, arg := range args {
+		if name, address, ok := strings.Cut(arg, "="); ok {
+			targets = append(targets, TargetConfig{Name: name, Address: address})
+		} else {
+			targets = append(targets, TargetConfig{Address: arg})
+		}
+	}
+	return targets
+}
+
+// ****************************************************************************
+// newEvent()
+// ****************************************************************************
+func newEvent(kind string, m *Monitor, message string) Event {
+	return Event{
+		Time:     time.Now(),
+		Type:     kind,
+		Target:   m.DisplayName(),
+		Address:  m.Config.Address,
+		Group:    m.Config.Group,
+		State:    m.Stats().State.String(),
+		Silenced: isSilenced(m.Config.Address, time.Now()),
+		Message:  message,
+	}
+}
+
+// ****************************************************************************
+// writeEvent()
+// ****************************************************************************
+func writeEvent(format string, ev Event) {
+	if format == "json" {
+		data, _ := json.Marshal(ev)
+		eventLog.Println(string(data))
+		return
+	}
+
+	line := fmt.Sprintf("%s %-8s %s", ev.Time.Format(time.RFC3339), ev.Type, ev.Address)
+	if ev.Type == "sample" {
+		if ev.Lost {
+			line += " lost"
+		} else {
+			line += fmt.Sprintf(" %.1f ms", ev.RTT)
+		}
+	} else {
+		line += " " + ev.Message
+	}
+	if ev.Silenced {
+		line += " (silenced)"
+	}
+	eventLog.Println(line)
+}
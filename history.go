@@ -0,0 +1,174 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var historyMutex sync.Mutex
+
+// ****************************************************************************
+// historyFilePath()
+// ****************************************************************************
+func historyFilePath(address string) (string, error) {
+	path, err := getAppFolderPath(AppFolderName)
+	if err != nil {
+		return "", err
+	}
+	folder := filepath.Join(path, HistoryFolderName)
+	if err := os.MkdirAll(folder, AppFolderMode); err != nil {
+		return "", err
+	}
+	// Keep the file name portable (IPv6 addresses contain colons)
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(address)
+	return filepath.Join(folder, name+".jsonl"), nil
+}
+
+// ****************************************************************************
+// appendHistory()
+// ****************************************************************************
+func appendHistory(address string, s Sample) error {
+	path, err := historyFilePath(address)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, AppFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ****************************************************************************
+// loadHistory()
+// ****************************************************************************
+func loadHistory(address string, since time.Time) ([]Sample, error) {
+	path, err := historyFilePath(address)
+	if err != nil {
+		return nil, err
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // No sample recorded yet
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Sample
+		if json.Unmarshal(scanner.Bytes(), &s) != nil {
+			continue // Skip truncated lines
+		}
+		if !s.Time.Before(since) {
+			samples = append(samples, s)
+		}
+	}
+	return samples, scanner.Err()
+}
+
+// ****************************************************************************
+// showHistoryDialog()
+// ****************************************************************************
+// Lists the recorded samples of a target over a period, the newest first
+func showHistoryDialog(parentWin fyne.Window, m *Monitor) {
+	var samples []Sample
+	summary := widget.NewLabel("Loading...")
+	list := widget.NewList(
+		func() int { return len(samples) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			s := samples[len(samples)-1-id]
+			text := fmt.Sprintf("%s  %.1f ms", s.Time.Format("2006-01-02 15:04:05"), s.RTT)
+			if s.Lost {
+				text = s.Time.Format("2006-01-02 15:04:05") + "  lost"
+			}
+			if s.Silenced {
+				text += "  (silenced)"
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+
+	periods := map[string]time.Duration{
+		"Last hour":     time.Hour,
+		"Last 24 hours": 24 * time.Hour,
+		"Last 7 days":   7 * 24 * time.Hour,
+	}
+	period := widget.NewSelect([]string{"Last hour", "Last 24 hours", "Last 7 days"}, func(value string) {
+		summary.SetText("Loading...")
+		go func() {
+			loaded, err := loadHistory(m.Config.Address, time.Now().Add(-periods[value]))
+			text := historySummary(loaded)
+			if err != nil {
+				text = err.Error()
+			}
+			fyne.Do(func() {
+				samples = loaded
+				summary.SetText(text)
+				list.Refresh()
+			})
+		}()
+	})
+	period.SetSelected("Last 24 hours")
+
+	content := container.NewBorder(container.NewVBox(period, summary), nil, nil, nil, list)
+	d := dialog.NewCustom("History of "+m.DisplayName(), "Close", content, parentWin)
+	d.Resize(fyne.NewSize(450, 500))
+	d.Show()
+}
+
+// ****************************************************************************
+// historySummary()
+// ****************************************************************************
+func historySummary(samples []Sample) string {
+	lost, total := 0, 0.0
+	for _, s := range samples {
+		if s.Lost {
+			lost++
+		} else {
+			total += s.RTT
+		}
+	}
+	if len(samples) == 0 {
+		return "No sample recorded"
+	}
+	average := 0.0
+	if lost < len(samples) {
+		average = total / float64(len(samples)-lost)
+	}
+	return fmt.Sprintf("%d samples, %d lost (%.1f %%), %.1f ms on average",
+		len(samples), lost, float64(lost)*100/float64(len(samples)), average)
+}
@@ -0,0 +1,120 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+// The incident log holds the state, flapping and anomaly events, oldest first.
+// The last IncidentsKept ones are kept in memory and the whole log is
+// appended to ~/.pingo/incidents.jsonl.
+var incidentMutex sync.Mutex
+var incidents []Event
+
+// ****************************************************************************
+// incidentsFilePath()
+// ****************************************************************************
+func incidentsFilePath() (string, error) {
+	path, err := getAppFolderPath(AppFolderName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path, AppFolderMode); err != nil {
+		return "", err
+	}
+	return filepath.Join(path, IncidentsFileName), nil
+}
+
+// ****************************************************************************
+// recordIncident()
+// ****************************************************************************
+func recordIncident(ev Event) error {
+	incidentMutex.Lock()
+	defer incidentMutex.Unlock()
+	incidents = append(incidents, ev)
+	if len(incidents) > IncidentsKept {
+		incidents = incidents[len(incidents)-IncidentsKept:]
+	}
+
+	path, err := incidentsFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, AppFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ****************************************************************************
+// loadIncidents()
+// ****************************************************************************
+// Reads back the last incidents recorded by a previous run
+func loadIncidents() error {
+	path, err := incidentsFilePath()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Nothing happened yet
+		}
+		return err
+	}
+	defer f.Close()
+
+	var loaded []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue // Skip truncated lines
+		}
+		loaded = append(loaded, ev)
+		if len(loaded) > 2*IncidentsKept {
+			loaded = loaded[len(loaded)-IncidentsKept:]
+		}
+	}
+	if len(loaded) > IncidentsKept {
+		loaded = loaded[len(loaded)-IncidentsKept:]
+	}
+
+	incidentMutex.Lock()
+	incidents = append(loaded, incidents...)
+	incidentMutex.Unlock()
+	return scanner.Err()
+}
+
+// ****************************************************************************
+// Incidents()
+// ****************************************************************************
+// Returns the incidents in memory, only those of a target when the address
+// is not empty
+func Incidents(address string) []Event {
+	incidentMutex.Lock()
+	defer incidentMutex.Unlock()
+	list := []Event{}
+	for _, ev := range incidents {
+		if address == "" || ev.Address == address {
+			list = append(list, ev)
+		}
+	}
+	return list
+}
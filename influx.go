@@ -0,0 +1,109 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var influxNameEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// ****************************************************************************
+// escapeInfluxName()
+// ****************************************************************************
+func escapeInfluxName(value string) string {
+	return influxNameEscaper.Replace(value)
+}
+
+// ****************************************************************************
+// influxLine()
+// ****************************************************************************
+// Encodes a sample in line protocol, e.g.
+// pingo,address=8.8.8.8,name=dns,probe=icmp rtt=12.3,lost=false 1700000000000000000
+func influxLine(measurement string, m *Monitor, s Sample) string {
+	var line strings.Builder
+	line.WriteString(measurement)
+	// Tags sorted by key as InfluxDB prefers, empty values are not allowed
+	for _, tag := range [][2]string{
+		{"address", m.Config.Address},
+		{"group", m.Config.Group},
+		{"name", m.DisplayName()},
+		{"probe", ProbeTypeICMP},
+	} {
+		if tag[1] != "" {
+			fmt.Fprintf(&line, ",%s=%s", tag[0], influxTagEscaper.Replace(tag[1]))
+		}
+	}
+	if s.Lost {
+		line.WriteString(" lost=true")
+	} else {
+		fmt.Fprintf(&line, " rtt=%s,lost=false", strconv.FormatFloat(s.RTT, 'f', -1, 64))
+	}
+	fmt.Fprintf(&line, " %d", s.Time.UnixNano())
+	return line.String()
+}
+
+// ****************************************************************************
+// influxHTTPWriter()
+// ****************************************************************************
+// Posts the lines to the write API, /api/v2/write (token) or /write (v1)
+func influxHTTPWriter(url, token string) func(lines []string) error {
+	client := &http.Client{Timeout: SinkTimeout * time.Second}
+	return func(lines []string) error {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("%s : %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil
+	}
+}
+
+// ****************************************************************************
+// influxUDPWriter()
+// ****************************************************************************
+// Sends the lines in datagrams small enough not to be fragmented
+func influxUDPWriter(host string) func(lines []string) error {
+	return func(lines []string) error {
+		conn, err := net.DialTimeout("udp", host, SinkTimeout*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		var packet []byte
+		for _, line := range lines {
+			if len(packet) > 0 && len(packet)+len(line)+1 > InfluxUDPPayload {
+				if _, err := conn.Write(packet); err != nil {
+					return err
+				}
+				packet = packet[:0]
+			}
+			packet = append(append(packet, line...), '\n')
+		}
+		_, err = conn.Write(packet)
+		return err
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// SyslogConfig describes the syslog server the log is also sent to
+type SyslogConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Network  string `json:"network,omitempty"`  // "udp" (default) or "tcp"
+	Address  string `json:"address,omitempty"`  // host:port, empty for the local syslog
+	Facility int    `json:"facility,omitempty"` // Default 16 (local0)
+}
+
+// logHandlers sends every record to several handlers
+type logHandlers []slog.Handler
+
+// rotatingFile is a log file renamed to .1, .2... once too large
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+// syslogWriter turns the JSON records into RFC 5424 messages, sent by its
+// own goroutine so that a slow server never blocks the caller
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	conn     net.Conn
+	queue    chan []byte
+}
+
+// consoleLevel is the log level, warnings at least
+type consoleLevel struct{}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var logLevel slog.LevelVar // Changed by the settings dialog, the handlers being built once
+
+// ****************************************************************************
+// startLogging()
+// ****************************************************************************
+// Makes the default logger write JSON records to ~/.pingo/pingo.log, the
+// warnings to stderr unless the terminal is taken by the dashboard and, when
+// enabled, everything to syslog
+func startLogging(settings AppSettings, console bool) error {
+	logLevel.Set(parseLogLevel(settings.LogLevel))
+	options := &slog.HandlerOptions{Level: &logLevel}
+	var handlers logHandlers
+	if console {
+		handlers = append(handlers, slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: consoleLevel{}}))
+	}
+
+	var errs []error
+	path, err := getAppFolderPath(AppFolderName)
+	if err == nil {
+		file := &rotatingFile{path: filepath.Join(path, LogFileName)}
+		if err = file.open(); err == nil {
+			handlers = append(handlers, slog.NewJSONHandler(file, options))
+		}
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("log file unavailable : %w", err))
+	}
+
+	if settings.Syslog.Enabled {
+		writer, err := newSyslogWriter(settings.Syslog)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("syslog unavailable : %w", err))
+		} else {
+			handlers = append(handlers, slog.NewJSONHandler(writer, options))
+		}
+	}
+
+	slog.SetDefault(slog.New(handlers))
+	return errors.Join(errs...)
+}
+
+// ****************************************************************************
+// subscribeLogging()
+// ****************************************************************************
+// Logs the application events of the bus, the target events being logged
+// with the incidents by publishEvents()
+func subscribeLogging() {
+	s := bus.Subscribe("log")
+	On(s, &bus.Status, func(msg StatusMessage) {
+		slog.Debug("status", "message", msg.Text, "severity", msg.Severity.String())
+	})
+	On(s, &bus.Updates, func(u UpdateAvailable) {
+		slog.Info("new version available", "version", Version, "remote", u.Remote)
+	})
+	On(s, &bus.Config, func(c ConfigChange) {
+		slog.Debug("targets changed", "targets", len(c.Targets))
+	})
+}
+
+// ****************************************************************************
+// parseLogLevel()
+// ****************************************************************************
+func parseLogLevel(value string) slog.Level {
+	var level slog.Level
+	if level.UnmarshalText([]byte(value)) != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// ****************************************************************************
+// logEvent()
+// ****************************************************************************
+// Logs a state, flapping or anomaly event, as a warning when it is bad news
+func logEvent(ev Event, warning bool) {
+	level := slog.LevelInfo
+	if warning {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, ev.Message,
+		"event", ev.Type, "target", ev.Target, "address", ev.Address,
+		"group", ev.Group, "state", ev.State, "silenced", ev.Silenced)
+}
+
+// ****************************************************************************
+// logTargetChanges()
+// ****************************************************************************
+// Logs the targets added, removed or modified between two configurations
+func logTargetChanges(before, after []TargetConfig) {
+	old := make(map[string]TargetConfig)
+	for _, t := range before {
+		old[t.Address] = t
+	}
+	for _, t := range after {
+		previous, ok := old[t.Address]
+		switch {
+		case !ok:
+			slog.Info("target added", "address", t.Address, "name", t.Name, "group", t.Group, "parent", t.Parent)
+		case !sameTarget(previous, t):
+			slog.Info("target modified", "address", t.Address, "name", t.Name, "group", t.Group, "parent", t.Parent, "paused", t.Paused)
+		}
+		delete(old, t.Address)
+	}
+	for _, t := range old {
+		slog.Info("target removed", "address", t.Address, "name", t.Name)
+	}
+}
+
+// ****************************************************************************
+// sameTarget()
+// ****************************************************************************
+func sameTarget(a, b TargetConfig) bool {
+	return a.Name == b.Name && a.Address == b.Address && a.Parent == b.Parent &&
+		a.Group == b.Group && slices.Equal(a.Tags, b.Tags) && a.Paused == b.Paused && a.Trace == b.Trace
+}
+
+// ****************************************************************************
+// consoleLevel
+// ****************************************************************************
+func (consoleLevel) Level() slog.Level {
+	return max(logLevel.Level(), slog.LevelWarn)
+}
+
+// ****************************************************************************
+// logHandlers
+// ****************************************************************************
+func (h logHandlers) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h logHandlers) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h logHandlers) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(logHandlers, len(h))
+	for idx, handler := range h {
+		handlers[idx] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h logHandlers) WithGroup(name string) slog.Handler {
+	handlers := make(logHandlers, len(h))
+	for idx, handler := range h {
+		handlers[idx] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// ****************************************************************************
+// rotatingFile
+// ****************************************************************************
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, AppFileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil && f.size+int64(len(p)) > LogMaxSize && f.size > 0 {
+		f.rotate()
+	}
+	if f.file == nil {
+		// The reopen after a rotation failed, tried again at every record
+		// without shifting the archives again
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Shifts pingo.log to pingo.log.1, pingo.log.1 to pingo.log.2... the oldest
+// one being deleted
+func (f *rotatingFile) rotate() {
+	f.file.Close()
+	f.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", f.path, LogFilesKept))
+	for idx := LogFilesKept - 1; idx >= 1; idx-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, idx), fmt.Sprintf("%s.%d", f.path, idx+1))
+	}
+	os.Rename(f.path, f.path+".1")
+	f.size = 0
+	f.open()
+}
+
+// ****************************************************************************
+// newSyslogWriter()
+// ****************************************************************************
+func newSyslogWriter(cfg SyslogConfig) (*syslogWriter, error) {
+	w := &syslogWriter{network: cfg.Network, address: cfg.Address, facility: cfg.Facility, queue: make(chan []byte, LogQueueSize)}
+	if w.facility <= 0 || w.facility > 23 {
+		w.facility = DefaultSyslogFacility
+	}
+	w.hostname, _ = os.Hostname()
+	switch {
+	case w.address == "":
+		w.network = "" // Local socket
+	case w.network == "":
+		w.network = "udp"
+	case w.network != "udp" && w.network != "tcp":
+		return nil, fmt.Errorf("syslog network must be udp or tcp, not %q", cfg.Network)
+	}
+	// A first connection reports a bad address at once, later failures are
+	// retried at the next message
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// ****************************************************************************
+// connect()
+// ****************************************************************************
+func (w *syslogWriter) connect() error {
+	var err error
+	if w.network != "" {
+		w.conn, err = net.DialTimeout(w.network, w.address, LogTimeout*time.Second)
+		return err
+	}
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		for _, network := range []string{"unixgram", "unix"} {
+			if w.conn, err = net.Dial(network, path); err == nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("no local syslog socket found")
+}
+
+// ****************************************************************************
+// Write()
+// ****************************************************************************
+// Receives one JSON record, queued as the message of a RFC 5424 line :
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	var record struct {
+		Level string `json:"level"`
+	}
+	json.Unmarshal(p, &record)
+	severity := 6 // Informational
+	switch parseLogLevel(record.Level) {
+	case slog.LevelDebug:
+		severity = 7
+	case slog.LevelWarn:
+		severity = 4
+	case slog.LevelError:
+		severity = 3
+	}
+	message := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		w.facility*8+severity, time.Now().UTC().Format(time.RFC3339Nano),
+		syslogField(w.hostname), syslogField(AppTitle), os.Getpid(), strings.TrimRight(string(p), "\n"))
+	if w.network == "tcp" {
+		message = fmt.Sprintf("%d %s", len(message), message) // Octet counting, RFC 6587
+	}
+
+	for {
+		select {
+		case w.queue <- []byte(message):
+			return len(p), nil
+		default:
+		}
+		// Full, make room by losing the oldest record
+		select {
+		case <-w.queue:
+		default:
+		}
+	}
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+// Sends the queued messages, a message which cannot be sent being lost and
+// the connection retried with the next one
+func (w *syslogWriter) run() {
+	for message := range w.queue {
+		if w.conn == nil && w.connect() != nil {
+			continue
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(LogTimeout * time.Second))
+		if _, err := w.conn.Write(message); err != nil {
+			w.conn.Close()
+			w.conn = nil
+		}
+	}
+}
+
+// ****************************************************************************
+// syslogField()
+// ****************************************************************************
+// Header fields are printable ASCII without spaces, "-" when empty
+func syslogField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -4,19 +4,22 @@ package main
 // IMPORTS
 // ****************************************************************************
 import (
+	"errors"
 	"fmt"
-	"image/color"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
@@ -27,17 +30,26 @@ import (
 var a fyne.App
 var w fyne.Window
 var split *container.Split
-var statusLabel = widget.NewLabel(StatusDefaultMessage)
-var lastMessageTime time.Time
-var statusChan = make(chan string, 10) // Buffer of 10 messages
+var detailSplit *container.Split
 var settings AppSettings
-var statusLight *canvas.Circle
-var statusMutex sync.Mutex
+var engine *Engine
 
 // ****************************************************************************
 // main()
 // ****************************************************************************
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	opts := parseOptions()
+	configPath = opts.ConfigPath
+	if opts.Headless {
+		os.Exit(runHeadless(opts))
+	}
+	if opts.Terminal {
+		os.Exit(runTerminalDashboard(opts))
+	}
+
 	a = app.NewWithID(AppID)
 	title := fmt.Sprintf("%s - v%s", AppTitle, GetDisplayVersion())
 	w = a.NewWindow(title)
@@ -52,25 +64,30 @@ func main() {
 		splitOffset = 0.33
 		settings.ThemePreference = "Light"
 		applyTheme(a, w, settings.ThemePreference)
-		showStatus("No settings found")
+		showWarning("No settings found")
 	} else {
 		width = float64(settings.WindowWidth)
 		height = float64(settings.WindowHeight)
 		splitOffset = float64(settings.SplitOffset)
 		applyTheme(a, w, settings.ThemePreference)
 	}
+	if err := startLogging(settings, true); err != nil {
+		showWarning(err.Error())
+	}
 	w.Resize(fyne.NewSize(float32(width), float32(height)))
 
 	// Save geometry when the window is closed
 	w.SetOnClosed(func() {
 		currSize := w.Content().Size()
-		settings = AppSettings{
-			WindowWidth:     currSize.Width,
-			WindowHeight:    currSize.Height,
-			SplitOffset:     split.Offset,
-			ThemePreference: settings.ThemePreference,
-		}
-		saveSettings(settings)
+		updateSettings(func(s *AppSettings) {
+			s.WindowWidth = currSize.Width
+			s.WindowHeight = currSize.Height
+			s.SplitOffset = split.Offset
+			s.DetailOffset = detailSplit.Offset
+		})
+		saveTargets()
+		saveBaselines(engine)
+		stopServices()
 	})
 
 	// Bind F3 to Exit
@@ -80,39 +97,144 @@ func main() {
 		}
 	})
 
-	// Usage
-	wid1 := NewPingWidget("192.168.1.254")
-	wid2 := NewPingWidget("8.8.8.8")
+	// Monitoring engine
+	engine = newEngineFromSettings(nil)
+	startAlerts()
 
-	// Left Panel (e.g., a list or navigation)
-	leftContent := container.NewVBox(
-		widget.NewLabel("Navigation"),
-		widget.NewButton("Setting A", func() {}),
-		widget.NewButton("Setting B", func() {}),
-	)
+	// Left Panel (targets tree, children under the target they depend on)
+	navTree = newDependencyTree()
+	leftContent := container.NewBorder(widget.NewLabel("Navigation"), nil, nil, nil, navTree)
 
-	// Right Panel (e.g., your main form)
-	rightContent := container.NewVBox(NewPingHeaderWidget(), wid1, wid2, layout.NewSpacer())
+	// Right Panel (the targets table over the detail of the clicked one)
+	detailSplit = container.NewVSplit(createTargetTable(), createDetailPane())
+	detailSplit.Offset = settings.DetailOffset
+	if detailSplit.Offset <= 0 {
+		detailSplit.Offset = 0.65
+	}
+	subscribeUI()
+	// Serve the metrics and the REST API
+	servicesErr := startServices(engine)
+	engine.StartAll()
 
 	// Create the Split Container
-	split = container.NewHSplit(leftContent, rightContent)
+	split = container.NewHSplit(leftContent, detailSplit)
 	split.Offset = splitOffset
 
 	// Assemble Layout
 	statusBar := createStatusBar()
 	mainLayout := container.NewBorder(nil, statusBar, nil, nil, split)
 	w.SetContent(mainLayout)
+	pendingChanges.health.Store(true)
+	go runTableFrames()
 
 	// Setup Menu
 	createMainMenu(w)
-	// Start the status manager
-	startStatusManager()
+	if servicesErr != nil {
+		showError(servicesErr.Error())
+	}
 	// Run update check in the background
-	go checkForUpdates(w)
+	go checkForUpdates()
 	// And the show must go on
 	w.ShowAndRun()
 }
 
+// ****************************************************************************
+// newEngineFromSettings()
+// ****************************************************************************
+// Builds the monitoring engine shared by the GUI and the headless mode, the
+// monitors are created but not started. Targets replace the configured ones
+// when not empty.
+func newEngineFromSettings(targets []TargetConfig) *Engine {
+	if settings.PingInterval <= 0 {
+		settings.PingInterval = DefaultPingInterval
+	}
+	if len(settings.Targets) == 0 {
+		settings.Targets = []TargetConfig{
+			{Address: "192.168.1.254"},
+			{Address: "8.8.8.8"},
+		}
+	}
+	if len(targets) == 0 {
+		targets = settings.Targets
+	}
+
+	e := NewEngine(time.Duration(settings.PingInterval) * time.Second)
+	baselines, _ := loadBaselines()
+	for _, target := range targets {
+		m := e.Add(target)
+		m.SetBaseline(baselines[target.Address])
+	}
+	return e
+}
+
+// ****************************************************************************
+// startServices()
+// ****************************************************************************
+// Starts the incident log and the HTTP endpoints enabled in the settings,
+// before the probing so that they see the first samples. A service failing
+// is logged and the others are started anyway.
+func startServices(e *Engine) error {
+	var errs []error
+	failed := func(service string, err error) {
+		slog.Error(service+" unavailable", "error", err)
+		errs = append(errs, fmt.Errorf("%s unavailable : %w", service, err))
+	}
+
+	loadIncidents()
+	subscribeLogging()
+	publishEvents()
+	startRouteTracing(e)
+	if err := startSinks(settings.Outputs); err != nil {
+		failed("outputs", err)
+	}
+	if settings.MQTT.Enabled {
+		if err := startMQTT(e, settings.MQTT); err != nil {
+			failed("MQTT", err)
+		}
+	}
+	// The Prometheus endpoint and OTLP share the counters
+	if settings.MetricsEnabled || settings.OTLP.Enabled {
+		collectMetrics()
+	}
+	if settings.OTLP.Enabled {
+		if err := startOTLP(e, settings.OTLP); err != nil {
+			failed("OTLP export", err)
+		}
+	}
+	if settings.MetricsEnabled {
+		address, port := metricsEndpoint(settings)
+		if err := startMetricsServer(e, address, port); err != nil {
+			failed("metrics endpoint", err)
+		}
+	}
+	if settings.APIEnabled {
+		if settings.APIToken == "" {
+			updateSettings(func(s *AppSettings) { s.APIToken = newAPIToken() })
+		}
+		address, port := apiEndpoint(settings)
+		if err := startAPIServer(e, address, port, settings.APIToken); err != nil {
+			failed("REST API", err)
+		}
+	}
+	if settings.WebEnabled {
+		address, port := webEndpoint(settings)
+		if err := startWebServer(e, address, port); err != nil {
+			failed("web dashboard", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ****************************************************************************
+// stopServices()
+// ****************************************************************************
+// Lets the outputs which hold a connection or pending data finish
+func stopServices() {
+	stopMQTT()
+	stopOTLP()
+	stopSinks()
+}
+
 // ****************************************************************************
 // createMainMenu()
 // ****************************************************************************
@@ -122,8 +244,36 @@ func createMainMenu(w fyne.Window) {
 	settingsItem := fyne.NewMenuItem("Settings", func() {
 		showSettingsDialog(w, a, &settings)
 	})
+	maintenanceItem := fyne.NewMenuItem("Maintenance Windows", func() {
+		showMaintenanceDialog(w)
+	})
+
+	webItem := fyne.NewMenuItem("Open Web Dashboard", func() {
+		if !settings.WebEnabled {
+			showWarning("The web dashboard is disabled in the settings")
+			return
+		}
+		address, port := webEndpoint(settings)
+		if ip := net.ParseIP(address); ip != nil && ip.IsUnspecified() {
+			address = "localhost" // Listening on all interfaces
+		}
+		u, _ := url.Parse("http://" + net.JoinHostPort(address, strconv.Itoa(port)) + "/")
+		a.OpenURL(u)
+	})
+
+	fileMenu := fyne.NewMenu("File", newItem, settingsItem, maintenanceItem, webItem)
 
-	fileMenu := fyne.NewMenu("File", newItem, settingsItem)
+	// Targets Menu
+	pauseAllItem := fyne.NewMenuItem("Pause All", func() { pauseAllTargets(true) })
+	resumeAllItem := fyne.NewMenuItem("Resume All", func() { pauseAllTargets(false) })
+	resetAllItem := fyne.NewMenuItem("Reset All Statistics", resetAllStats)
+	targetsMenu := fyne.NewMenu("Targets", pauseAllItem, resumeAllItem, fyne.NewMenuItemSeparator(), resetAllItem)
+
+	// View Menu
+	columnsItem := fyne.NewMenuItem("Columns", func() {
+		showColumnsDialog(w)
+	})
+	viewMenu := fyne.NewMenu("View", columnsItem)
 
 	// Help Menu
 	aboutItem := fyne.NewMenuItem("About", func() {
@@ -132,113 +282,45 @@ func createMainMenu(w fyne.Window) {
 	helpMenu := fyne.NewMenu("Help", aboutItem)
 
 	// Set the Main Menu
-	mainMenu := fyne.NewMainMenu(fileMenu, helpMenu)
+	mainMenu := fyne.NewMainMenu(fileMenu, targetsMenu, viewMenu, helpMenu)
 	w.SetMainMenu(mainMenu)
 }
 
 // ****************************************************************************
-// createStatusBar()
+// subscribeUI()
 // ****************************************************************************
-func createStatusBar() fyne.CanvasObject {
-	statusLight = canvas.NewCircle(ColorGreen)
-	statusLight.StrokeColor = ColorBlack
-	statusLight.StrokeWidth = 1
-	rect := canvas.NewRectangle(color.Transparent)
-	rect.SetMinSize(fyne.NewSize(16, 16)) // This forces the "slot" to be 16x16
-	lightContainer := container.NewStack(rect, statusLight)
-	centeredLight := container.NewCenter(lightContainer)
-
-	versionLabel := widget.NewLabel(Version)
-	versionLabel.TextStyle = fyne.TextStyle{Italic: true} // Make it look distinct
-
-	barContent := container.NewHBox(
-		centeredLight,
-		statusLabel,
-		layout.NewSpacer(), // PUSHES everything apart
-		versionLabel,       // Stays on the RIGHT
-	)
-
-	line := canvas.NewRectangle(ColorLightGrey)
-	line.SetMinSize(fyne.NewSize(0, 1))
-
-	return container.NewVBox(
-		line,
-		barContent,
-	)
-}
-
-// ****************************************************************************
-// startStatusManager()
-// ****************************************************************************
-func startStatusManager() {
-	go func() {
-		for msg := range statusChan {
-			// Set the new message
-			fyne.Do(func() {
-				statusLabel.SetText(msg)
-				statusLabel.Refresh()
-			})
-
-			// Wait for the timeout
-			time.Sleep(time.Duration(StatusTimeout) * time.Second)
-
-			// Only reset to "Ready" if there isn't a newer message waiting
-			if len(statusChan) == 0 {
-				fyne.Do(func() {
-					statusLabel.SetText(StatusDefaultMessage)
-					statusLabel.Refresh()
-				})
-			}
-		}
-	}()
-}
-
-// ****************************************************************************
-// showStatus()
-// ****************************************************************************
-func showStatus(message string) {
-	statusMutex.Lock()
-	now := time.Now()
-	lastMessageTime = now
-	statusMutex.Unlock()
-
-	fyne.Do(func() {
-		statusLabel.SetText(message)
-
-		// Change light to Yellow if not Ready
-		if message != StatusDefaultMessage {
-			statusLight.FillColor = ColorYellow
-		} else {
-			statusLight.FillColor = ColorGreen
-		}
-
-		statusLight.Refresh()
-		statusLabel.Refresh()
+// Keeps the window in step with the bus, the targets changes being only
+// noted for the next frame of the table
+func subscribeUI() {
+	s := bus.Subscribe("ui")
+	On(s, &bus.Samples, func(ProbeResult) { pendingChanges.rows.Store(true) })
+	On(s, &bus.States, func(StateChange) { pendingChanges.health.Store(true) })
+	On(s, &bus.Flaps, func(FlapChange) { pendingChanges.health.Store(true) })
+	On(s, &bus.Anomalies, func(AnomalyChange) { pendingChanges.health.Store(true) })
+	On(s, &bus.Config, func(ConfigChange) {
+		pendingChanges.order.Store(true)
+		pendingChanges.health.Store(true)
+	})
+	On(s, &bus.Status, renderStatus)
+	On(s, &bus.Updates, func(u UpdateAvailable) {
+		fyne.Do(func() {
+			dialog.ShowInformation("Update Available",
+				"A new version is available on GitHub!\nRemote Hash: "+u.Remote,
+				w)
+		})
+		showStatus("A new version is available on GitHub")
 	})
-
-	// Reset timer logic...
-	go func() {
-		time.Sleep(StatusTimeout * time.Second)
-		statusMutex.Lock()
-		isLast := lastMessageTime.Equal(now)
-		statusMutex.Unlock()
-
-		if isLast {
-			fyne.Do(func() {
-				statusLabel.SetText(StatusDefaultMessage)
-				statusLight.FillColor = ColorGreen
-				statusLight.Refresh()
-				statusLabel.Refresh()
-			})
-		}
-	}()
 }
 
 // ****************************************************************************
 // GetPingTime()
 // ****************************************************************************
-func GetPingTime(target string) (string, error) {
-	delimiter := settings.PingDelimiter
+// Returns the time of the answer, and its TTL when the ping command shows it
+func GetPingTime(target string) (string, int, error) {
+	delimiter := currentSettings().PingDelimiter
+	if delimiter == "" {
+		delimiter = DefaultPingDelimiter
+	}
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd = exec.Command("ping", "-n", "1", target)
@@ -248,11 +330,25 @@ func GetPingTime(target string) (string, error) {
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	// Look for the "time=" string in the output
+	// "ttl=57" on Unix, "TTL=57" on Windows
 	output := string(out)
+	ttl := 0
+	if idx := strings.Index(strings.ToLower(output), "ttl="); idx >= 0 {
+		fields := strings.Fields(output[idx+len("ttl="):])
+		if len(fields) > 0 {
+			ttl, _ = strconv.Atoi(fields[0])
+		}
+	}
+
+	// Windows shows "time<1ms" below a millisecond
+	if delimiter == DefaultPingDelimiter {
+		output = strings.ReplaceAll(output, "time<", "time=<")
+	}
+
+	// Look for the "time=" string in the output
 	if strings.Contains(output, delimiter) {
 		// Simple logic to extract the part after "time="
 		parts := strings.Split(output, delimiter)
@@ -260,9 +356,9 @@ func GetPingTime(target string) (string, error) {
 			// Get everything after the delimiter, then grab the first word (the number)
 			afterDelimiter := strings.TrimSpace(parts[1])
 			timeValue := strings.Split(afterDelimiter, " ")
-			return timeValue[0], nil // e.g. "14.2"
+			return timeValue[0], ttl, nil // e.g. "14.2", "14ms" or "<1ms"
 		}
 	}
 
-	return "unknown", nil
+	return "unknown", ttl, nil
 }
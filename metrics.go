@@ -0,0 +1,179 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// targetMetrics accumulates the samples of one target since its first one
+type targetMetrics struct {
+	buckets []uint64 // Cumulative counts, one per MetricsBuckets entry
+	sum     float64  // Seconds
+	probes  uint64
+	lost    uint64
+	start   time.Time // Start of the cumulative counters
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+// Histogram bounds of the RTT, in seconds as Prometheus expects
+var MetricsBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+var metricsMutex sync.Mutex
+var metricsByTarget = make(map[string]*targetMetrics) // By address, an edit replacing the Monitor
+
+// ****************************************************************************
+// collectMetrics()
+// ****************************************************************************
+// Accumulates the samples of the bus for the metrics endpoint and OTLP
+func collectMetrics() {
+	On(bus.Subscribe("metrics"), &bus.Samples, func(r ProbeResult) {
+		recordMetrics(r.Monitor, r.Sample)
+	})
+}
+
+// ****************************************************************************
+// recordMetrics()
+// ****************************************************************************
+func recordMetrics(m *Monitor, s Sample) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	tm, ok := metricsByTarget[m.Config.Address]
+	if !ok {
+		tm = &targetMetrics{buckets: make([]uint64, len(MetricsBuckets)), start: s.Time}
+		metricsByTarget[m.Config.Address] = tm
+	}
+
+	tm.probes++
+	if s.Lost {
+		tm.lost++
+		return
+	}
+	seconds := s.RTT / 1000
+	tm.sum += seconds
+	for idx, bound := range MetricsBuckets {
+		if seconds <= bound {
+			tm.buckets[idx]++
+		}
+	}
+}
+
+// ****************************************************************************
+// startMetricsServer()
+// ****************************************************************************
+// Serves the Prometheus text format on /metrics, returns once listening
+func startMetricsServer(e *Engine, address string, port int) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, e)
+	})
+	go http.Serve(listener, mux)
+	return nil
+}
+
+// ****************************************************************************
+// writeMetrics()
+// ****************************************************************************
+func writeMetrics(w io.Writer, e *Engine) {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	monitors := e.Monitors()
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	forgetDeletedMetrics(monitors)
+
+	fmt.Fprintln(out, "# HELP pingo_up Whether the target answers (1) or not (0).")
+	fmt.Fprintln(out, "# TYPE pingo_up gauge")
+	for _, m := range monitors {
+		up := 0
+		if m.Stats().State == StateUp {
+			up = 1
+		}
+		fmt.Fprintf(out, "pingo_up{%s} %d\n", metricsLabels(m), up)
+	}
+
+	fmt.Fprintln(out, "# HELP pingo_probes_total Probes sent to the target.")
+	fmt.Fprintln(out, "# TYPE pingo_probes_total counter")
+	for _, m := range monitors {
+		if tm, ok := metricsByTarget[m.Config.Address]; ok {
+			fmt.Fprintf(out, "pingo_probes_total{%s} %d\n", metricsLabels(m), tm.probes)
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP pingo_probes_lost_total Probes left without answer.")
+	fmt.Fprintln(out, "# TYPE pingo_probes_lost_total counter")
+	for _, m := range monitors {
+		if tm, ok := metricsByTarget[m.Config.Address]; ok {
+			fmt.Fprintf(out, "pingo_probes_lost_total{%s} %d\n", metricsLabels(m), tm.lost)
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP pingo_rtt_seconds Round trip time of the answered probes.")
+	fmt.Fprintln(out, "# TYPE pingo_rtt_seconds histogram")
+	for _, m := range monitors {
+		tm, ok := metricsByTarget[m.Config.Address]
+		if !ok {
+			continue
+		}
+		labels := metricsLabels(m)
+		for idx, bound := range MetricsBuckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(out, "pingo_rtt_seconds_bucket{%s,le=\"%s\"} %d\n", labels, le, tm.buckets[idx])
+		}
+		answered := tm.probes - tm.lost
+		fmt.Fprintf(out, "pingo_rtt_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, answered)
+		fmt.Fprintf(out, "pingo_rtt_seconds_sum{%s} %g\n", labels, tm.sum)
+		fmt.Fprintf(out, "pingo_rtt_seconds_count{%s} %d\n", labels, answered)
+	}
+
+	fmt.Fprintln(out, "# HELP pingo_bus_dropped_events_total Events a too slow subscriber lost.")
+	fmt.Fprintln(out, "# TYPE pingo_bus_dropped_events_total counter")
+	for _, d := range bus.Drops() {
+		fmt.Fprintf(out, "pingo_bus_dropped_events_total{subscriber=\"%s\"} %d\n", d.Subscriber, d.Dropped)
+	}
+}
+
+// ****************************************************************************
+// forgetDeletedMetrics()
+// ****************************************************************************
+// Drops the metrics of the targets which are gone, metricsMutex being held
+func forgetDeletedMetrics(monitors []*Monitor) {
+	live := make(map[string]bool)
+	for _, m := range monitors {
+		live[m.Config.Address] = true
+	}
+	for address := range metricsByTarget {
+		if !live[address] {
+			delete(metricsByTarget, address)
+		}
+	}
+}
+
+// ****************************************************************************
+// metricsLabels()
+// ****************************************************************************
+func metricsLabels(m *Monitor) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+	return fmt.Sprintf(`name="%s",address="%s",group="%s",probe="%s"`,
+		escape(m.DisplayName()), escape(m.Config.Address), escape(m.Config.Group), ProbeTypeICMP)
+}
@@ -0,0 +1,657 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+type TargetConfig struct {
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Parent  string   `json:"parent,omitempty"` // Address of the target this one depends on
+	Group   string   `json:"group,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Paused  bool     `json:"paused,omitempty"` // Not probed until resumed
+	Trace   bool     `json:"trace,omitempty"`  // Traced every RouteInterval minutes to detect route changes
+}
+
+type TargetState int
+
+const (
+	StateUnknown TargetState = iota
+	StateUp
+	StateDown
+	StateUnreachable // Down, but only because its parent is down
+)
+
+type Sample struct {
+	Time     time.Time `json:"time"`
+	RTT      float64   `json:"rtt"` // Milliseconds, 0 when lost
+	Lost     bool      `json:"lost"`
+	Silenced bool      `json:"silenced,omitempty"`
+	TTL      int       `json:"ttl,omitempty"` // Of the echo reply, 0 when unknown
+}
+
+type TargetStats struct {
+	Last      float64     `json:"last"`
+	Average   float64     `json:"average"`
+	Min       float64     `json:"min"`
+	Max       float64     `json:"max"`
+	Jitter    float64     `json:"jitter"` // Smoothed variation between two answers, RFC 3550
+	Requests  int         `json:"requests"`
+	Lost      int         `json:"lost"`
+	State     TargetState `json:"state"`
+	FlapScore float64     `json:"flap_score"` // Percent of weighted state changes over the flap window
+	Flapping  bool        `json:"flapping"`
+	Sigmas    float64     `json:"sigmas"` // Deviation of the last RTT from the learned baseline
+	Anomaly   bool        `json:"anomaly"`
+}
+
+// stateChanges reports what a probe changed beyond the running statistics
+type stateChanges struct {
+	from           TargetState
+	to             TargetState
+	flapChanged    bool
+	flapping       bool // Flapping after the probe
+	anomalyChanged bool
+	ttlFrom        int // TTLs of the replies when they changed, 0 otherwise
+	ttlTo          int
+}
+
+type Monitor struct {
+	Config    TargetConfig
+	engine    *Engine
+	mu        sync.Mutex
+	stats     TargetStats
+	samples   []Sample // Most recent samples, oldest first
+	hostname  string
+	lostInRow int
+	upHistory []bool // Up or not after each of the last FlapWindow probes
+	baseline  BaselineSet
+	anomalies int // Anomalous samples in a row
+	ttl       int // Usual TTL of the replies, 0 until the first one
+	ttlNew    int // Different TTL seen ttlSeen times in a row
+	ttlSeen   int
+	stop      chan struct{}
+}
+
+// Engine runs the monitors, publishing their results and changes on the bus
+type Engine struct {
+	Interval time.Duration
+	mu       sync.Mutex
+	monitors []*Monitor
+	prober   func(address string) Sample // probeOnce() unless replaced by the tests
+	running  sync.WaitGroup              // Goroutines of the monitors
+}
+
+// ****************************************************************************
+// String()
+// ****************************************************************************
+func (s TargetState) String() string {
+	switch s {
+	case StateUp:
+		return "up"
+	case StateDown:
+		return "down"
+	case StateUnreachable:
+		return "unreachable due to parent"
+	default:
+		return "unknown"
+	}
+}
+
+// ****************************************************************************
+// MarshalText()
+// ****************************************************************************
+func (s TargetState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ****************************************************************************
+// NewEngine()
+// ****************************************************************************
+func NewEngine(interval time.Duration) *Engine {
+	return &Engine{Interval: interval, prober: probeOnce}
+}
+
+// ****************************************************************************
+// Add()
+// ****************************************************************************
+func (e *Engine) Add(cfg TargetConfig) *Monitor {
+	m := &Monitor{
+		Config:   cfg,
+		engine:   e,
+		hostname: cfg.Name,
+	}
+	e.mu.Lock()
+	e.monitors = append(e.monitors, m)
+	e.mu.Unlock()
+	e.targetsChanged()
+	return m
+}
+
+// ****************************************************************************
+// TryAdd()
+// ****************************************************************************
+// Adds a target unless its address is already monitored, returns nil then
+func (e *Engine) TryAdd(cfg TargetConfig) *Monitor {
+	e.mu.Lock()
+	for _, m := range e.monitors {
+		if m.Config.Address == cfg.Address {
+			e.mu.Unlock()
+			return nil
+		}
+	}
+	m := &Monitor{Config: cfg, engine: e, hostname: cfg.Name}
+	e.monitors = append(e.monitors, m)
+	e.mu.Unlock()
+	e.targetsChanged()
+	return m
+}
+
+// ****************************************************************************
+// Remove()
+// ****************************************************************************
+func (e *Engine) Remove(address string) *Monitor {
+	e.mu.Lock()
+	for idx, m := range e.monitors {
+		if m.Config.Address == address {
+			m.Stop()
+			e.monitors = append(e.monitors[:idx], e.monitors[idx+1:]...)
+			e.mu.Unlock()
+			e.targetsChanged()
+			return m
+		}
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+// ****************************************************************************
+// Update()
+// ****************************************************************************
+// Replaces the configuration of a target by swapping its monitor for a new
+// one at the same position, keeping what was learned when the address stays
+func (e *Engine) Update(address string, cfg TargetConfig) *Monitor {
+	e.mu.Lock()
+	idx := -1
+	for i, m := range e.monitors {
+		if m.Config.Address == address {
+			idx = i
+		} else if m.Config.Address == cfg.Address {
+			e.mu.Unlock()
+			return nil // The new address is already monitored
+		}
+	}
+	if idx < 0 {
+		e.mu.Unlock()
+		return nil
+	}
+
+	old := e.monitors[idx]
+	running := old.Running()
+	old.Stop()
+	m := &Monitor{Config: cfg, engine: e, hostname: cfg.Name}
+	if cfg.Address == address {
+		old.mu.Lock()
+		m.stats = old.stats
+		m.samples = append([]Sample(nil), old.samples...)
+		m.upHistory = append([]bool(nil), old.upHistory...)
+		m.baseline = old.baseline
+		m.lostInRow = old.lostInRow
+		m.anomalies = old.anomalies
+		m.ttl = old.ttl
+		if cfg.Name == "" {
+			m.hostname = old.hostname
+		}
+		old.mu.Unlock()
+	}
+	e.monitors[idx] = m
+	e.mu.Unlock()
+
+	// A target being resumed starts even when the engine was not running it
+	if !cfg.Paused && (running || old.Config.Paused) {
+		m.Start()
+	}
+	e.targetsChanged()
+	return m
+}
+
+// ****************************************************************************
+// SetPaused()
+// ****************************************************************************
+// Stops or resumes probing a target, its statistics being kept
+func (e *Engine) SetPaused(address string, paused bool) *Monitor {
+	m := e.Find(address)
+	if m == nil {
+		return nil
+	}
+	cfg := m.Config
+	cfg.Paused = paused
+	return e.Update(address, cfg) // nil when removed meanwhile
+}
+
+// ****************************************************************************
+// StartAll()
+// ****************************************************************************
+// Starts the monitors of the targets which are not paused
+func (e *Engine) StartAll() {
+	for _, m := range e.Monitors() {
+		if !m.Config.Paused {
+			m.Start()
+		}
+	}
+}
+
+// ****************************************************************************
+// Wait()
+// ****************************************************************************
+// Waits for the goroutines of the stopped monitors to end, after their
+// probe in progress
+func (e *Engine) Wait() {
+	e.running.Wait()
+}
+
+// ****************************************************************************
+// targetsChanged()
+// ****************************************************************************
+func (e *Engine) targetsChanged() {
+	bus.Config.Publish(ConfigChange{Targets: e.Targets()})
+}
+
+// ****************************************************************************
+// Find()
+// ****************************************************************************
+func (e *Engine) Find(address string) *Monitor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, m := range e.monitors {
+		if m.Config.Address == address {
+			return m
+		}
+	}
+	return nil
+}
+
+// ****************************************************************************
+// Monitors()
+// ****************************************************************************
+func (e *Engine) Monitors() []*Monitor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Monitor(nil), e.monitors...)
+}
+
+// ****************************************************************************
+// Targets()
+// ****************************************************************************
+func (e *Engine) Targets() []TargetConfig {
+	var targets []TargetConfig
+	for _, m := range e.Monitors() {
+		targets = append(targets, m.Config)
+	}
+	return targets
+}
+
+// ****************************************************************************
+// Parent()
+// ****************************************************************************
+// Returns the monitor m depends on, or nil when it has none, when the parent
+// is not monitored or when following parents leads back to m
+func (e *Engine) Parent(m *Monitor) *Monitor {
+	parent := e.Find(m.Config.Parent)
+	for p, hops := parent, 0; p != nil && hops < MaxDependencyDepth; hops++ {
+		if p == m {
+			return nil
+		}
+		p = e.Find(p.Config.Parent)
+	}
+	return parent
+}
+
+// ****************************************************************************
+// parentDown()
+// ****************************************************************************
+func (e *Engine) parentDown(m *Monitor) bool {
+	parent := e.Parent(m)
+	if parent == nil {
+		return false
+	}
+	state := parent.Stats().State
+	return state == StateDown || state == StateUnreachable
+}
+
+// ****************************************************************************
+// Start()
+// ****************************************************************************
+func (m *Monitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return // Already running
+	}
+	m.stop = make(chan struct{})
+	m.engine.running.Add(1)
+	go m.run(m.stop)
+}
+
+// ****************************************************************************
+// Stop()
+// ****************************************************************************
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// ****************************************************************************
+// Running()
+// ****************************************************************************
+func (m *Monitor) Running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stop != nil
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+func (m *Monitor) run(stop chan struct{}) {
+	defer m.engine.running.Done()
+	m.resolveHostname()
+	for {
+		m.probe()
+		select {
+		case <-stop:
+			return
+		case <-time.After(m.engine.Interval):
+		}
+	}
+}
+
+// ****************************************************************************
+// probe()
+// ****************************************************************************
+func (m *Monitor) probe() {
+	sample := m.engine.prober(m.Config.Address)
+	sample.Silenced = isSilenced(m.Config.Address, sample.Time)
+
+	changes := m.record(sample, m.engine.parentDown(m))
+	appendHistory(m.Config.Address, sample)
+
+	bus.Samples.Publish(ProbeResult{Monitor: m, Sample: sample})
+	if changes.flapChanged {
+		bus.Flaps.Publish(FlapChange{Monitor: m, Flapping: changes.flapping})
+	}
+	if changes.from != changes.to {
+		bus.States.Publish(StateChange{Monitor: m, From: changes.from, To: changes.to, Flapping: changes.flapping})
+	}
+	if changes.anomalyChanged {
+		bus.Anomalies.Publish(AnomalyChange{Monitor: m, Anomaly: m.Stats().Anomaly})
+	}
+	if changes.ttlTo != 0 {
+		bus.Routes.Publish(RouteChange{Monitor: m, OldTTL: changes.ttlFrom, NewTTL: changes.ttlTo})
+	}
+}
+
+// ****************************************************************************
+// probeOnce()
+// ****************************************************************************
+func probeOnce(address string) Sample {
+	sample := Sample{Time: time.Now()}
+	value, ttl, err := GetPingTime(address)
+	rtt, convErr := parseRTT(value)
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		slog.Debug("probe lost", "address", address, "exit", exitErr.ExitCode())
+	case err != nil:
+		slog.Error("probe failed", "address", address, "error", err)
+	case convErr != nil:
+		slog.Warn("no time in the ping answer, check the ping delimiter", "address", address, "value", value)
+	}
+	if err != nil || convErr != nil {
+		sample.Lost = true
+	} else {
+		sample.RTT, sample.TTL = rtt, ttl
+	}
+	return sample
+}
+
+// ****************************************************************************
+// parseRTT()
+// ****************************************************************************
+// Reads "14.2" as well as "14ms" and "<1ms" from Windows, the latter being
+// taken as 1 ms
+func parseRTT(value string) (float64, error) {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "<"), "ms")
+	return strconv.ParseFloat(value, 64)
+}
+
+// ****************************************************************************
+// record()
+// ****************************************************************************
+func (m *Monitor) record(s Sample, parentDown bool) stateChanges {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := stateChanges{from: m.stats.State}
+	m.stats.Requests++
+	if s.Lost {
+		m.stats.Lost++
+		m.lostInRow++
+		if m.lostInRow >= DownAfterLost {
+			if parentDown {
+				m.stats.State = StateUnreachable
+			} else {
+				m.stats.State = StateDown
+			}
+		}
+	} else {
+		m.stats.addAnswer(s.RTT)
+		m.lostInRow = 0
+		changes.ttlFrom, changes.ttlTo = m.observeTTL(s.TTL)
+		m.stats.State = StateUp
+
+		m.stats.Sigmas = m.baseline.observe(s.Time, s.RTT, currentSettings().BaselinePerHour)
+		if m.stats.Sigmas >= anomalySigmas() {
+			m.anomalies++
+		} else {
+			m.anomalies = 0
+		}
+		anomaly := m.anomalies >= AnomalyAfter
+		changes.anomalyChanged = anomaly != m.stats.Anomaly
+		m.stats.Anomaly = anomaly
+	}
+
+	m.samples = append(m.samples, s)
+	if len(m.samples) > SamplesKept {
+		m.samples = m.samples[len(m.samples)-SamplesKept:]
+	}
+	changes.flapChanged = m.updateFlapping()
+	changes.flapping = m.stats.Flapping
+	changes.to = m.stats.State
+	return changes
+}
+
+// ****************************************************************************
+// observeTTL()
+// ****************************************************************************
+// A TTL change hints at a new route, it is reported once the new TTL was seen
+// TTLChangeAfter times in a row. Returns the old and the new TTL, 0 and 0
+// when nothing changed.
+func (m *Monitor) observeTTL(ttl int) (int, int) {
+	switch {
+	case ttl == 0:
+		return 0, 0 // Not shown by the ping command
+	case m.ttl == 0:
+		m.ttl = ttl
+	case ttl == m.ttl:
+		m.ttlNew, m.ttlSeen = 0, 0
+	case ttl == m.ttlNew:
+		m.ttlSeen++
+	default:
+		m.ttlNew, m.ttlSeen = ttl, 1
+	}
+	if m.ttlSeen < TTLChangeAfter {
+		return 0, 0
+	}
+	from := m.ttl
+	m.ttl, m.ttlNew, m.ttlSeen = ttl, 0, 0
+	return from, ttl
+}
+
+// ****************************************************************************
+// addAnswer()
+// ****************************************************************************
+// Updates the RTT statistics with an answer, the request being already counted
+func (s *TargetStats) addAnswer(rtt float64) {
+	received := float64(s.Requests - s.Lost)
+	if received > 1 {
+		s.Jitter += (math.Abs(rtt-s.Last) - s.Jitter) / 16
+	}
+	s.Last = rtt
+	s.Average += (rtt - s.Average) / received
+	if received == 1 || rtt < s.Min {
+		s.Min = rtt
+	}
+	if rtt > s.Max {
+		s.Max = rtt
+	}
+}
+
+// ****************************************************************************
+// LossPercent()
+// ****************************************************************************
+func (s TargetStats) LossPercent() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Lost) * 100 / float64(s.Requests)
+}
+
+// ****************************************************************************
+// MOS()
+// ****************************************************************************
+// Estimates the voice quality from 1 (bad) to 4.5 (excellent) with the
+// simplified E-model, 0 before the first answer
+func (s TargetStats) MOS() float64 {
+	if s.Requests == s.Lost {
+		return 0
+	}
+	latency := s.Average + 2*s.Jitter + 10 // Round trip, jitter counted twice, codec delay
+	r := 93.2 - latency/40
+	if latency >= 160 {
+		r = 93.2 - (latency-120)/10
+	}
+	r = max(r-2.5*s.LossPercent(), 0)
+	return 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+}
+
+// ****************************************************************************
+// Stats()
+// ****************************************************************************
+func (m *Monitor) Stats() TargetStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// ****************************************************************************
+// ResetStats()
+// ****************************************************************************
+// Starts the running statistics over. The state, the flapping and anomaly
+// detection, the history and the baseline are kept.
+func (m *Monitor) ResetStats() {
+	m.mu.Lock()
+	m.stats = TargetStats{
+		State:     m.stats.State,
+		FlapScore: m.stats.FlapScore,
+		Flapping:  m.stats.Flapping,
+		Sigmas:    m.stats.Sigmas,
+		Anomaly:   m.stats.Anomaly,
+	}
+	m.samples = nil
+	m.mu.Unlock()
+}
+
+// ****************************************************************************
+// Baseline()
+// ****************************************************************************
+func (m *Monitor) Baseline() BaselineSet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.baseline
+}
+
+// ****************************************************************************
+// SetBaseline()
+// ****************************************************************************
+func (m *Monitor) SetBaseline(bs BaselineSet) {
+	m.mu.Lock()
+	m.baseline = bs
+	m.mu.Unlock()
+}
+
+// ****************************************************************************
+// Samples()
+// ****************************************************************************
+func (m *Monitor) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Sample(nil), m.samples...)
+}
+
+// ****************************************************************************
+// Hostname()
+// ****************************************************************************
+func (m *Monitor) Hostname() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hostname == "" {
+		return "unknown"
+	}
+	return m.hostname
+}
+
+// ****************************************************************************
+// DisplayName()
+// ****************************************************************************
+func (m *Monitor) DisplayName() string {
+	if m.Config.Name != "" {
+		return m.Config.Name
+	}
+	return m.Config.Address
+}
+
+// ****************************************************************************
+// resolveHostname()
+// ****************************************************************************
+func (m *Monitor) resolveHostname() {
+	if m.Config.Name != "" {
+		return
+	}
+	names, err := net.LookupAddr(m.Config.Address)
+	if err != nil || len(names) == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.hostname = strings.TrimSuffix(names[0], ".")
+	m.mu.Unlock()
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// ****************************************************************************
+// TestParseRTT()
+// ****************************************************************************
+func TestParseRTT(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"14.2", 14.2},
+		{"14ms", 14},
+		{"<1ms", 1},
+		{"0.045", 0.045},
+	}
+	for _, tt := range tests {
+		got, err := parseRTT(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseRTT(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "unknown", "ms"} {
+		if _, err := parseRTT(value); err == nil {
+			t.Errorf("parseRTT(%q) accepted", value)
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// MQTTConfig describes the broker the target status and samples are
+// published to. Topics take the {name}, {address}, {group} and {probe}
+// fields of the target.
+type MQTTConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Broker      string `json:"broker"`  // tcp://host:1883, or tls://host:8883 (also ssl:// and mqtts://)
+	Version     int    `json:"version"` // 4 for MQTT 3.1.1 (default), 5 for MQTT 5
+	ClientID    string `json:"client_id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	QoS         byte   `json:"qos"`                    // 0 or 1
+	StatusTopic string `json:"status_topic,omitempty"` // Retained
+	SampleTopic string `json:"sample_topic,omitempty"`
+	WillTopic   string `json:"will_topic,omitempty"` // Retained "online", or "offline" once pingo is gone
+	CACert      string `json:"ca_cert,omitempty"`    // PEM files
+	ClientCert  string `json:"client_cert,omitempty"`
+	ClientKey   string `json:"client_key,omitempty"`
+	Insecure    bool   `json:"insecure,omitempty"` // Skip the broker certificate check
+}
+
+// MQTTClient publishes to a broker, reconnecting when the connection drops.
+// Messages are queued while disconnected, the oldest being lost once the
+// queue is full, and unacknowledged QoS 1 messages are sent again in the
+// session kept by the broker. At most MQTTInflight messages wait for their
+// PUBACK, the queue holding the next ones.
+type MQTTClient struct {
+	config   MQTTConfig
+	address  string
+	tls      *tls.Config
+	queue    chan mqttMessage
+	mu       sync.Mutex // Guards conn, reader, packetID and inflight
+	writeMu  sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	inflight map[uint16]mqttMessage
+	retained map[string]bool // Status topics published, cleared when a target goes
+	closed   chan struct{}
+	done     chan struct{}
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+	id      uint16 // Packet identifier once sent with QoS 1, 0 before
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var mqttClient *MQTTClient
+
+// Control packet types, in the high nibble of the fixed header
+const (
+	mqttConnect    = 0x10
+	mqttConnAck    = 0x20
+	mqttPublish    = 0x30
+	mqttPubAck     = 0x40
+	mqttPingReq    = 0xC0
+	mqttPingResp   = 0xD0
+	mqttDisconnect = 0xE0
+)
+
+// ****************************************************************************
+// startMQTT()
+// ****************************************************************************
+// Connects to the broker in the background and subscribes to the bus so that
+// samples and status changes are published
+func startMQTT(e *Engine, cfg MQTTConfig) error {
+	client, err := newMQTTClient(cfg)
+	if err != nil {
+		return err
+	}
+	mqttClient = client
+	go client.run(e)
+
+	s := bus.Subscribe("mqtt")
+	On(s, &bus.Samples, func(r ProbeResult) { client.publishSample(r.Monitor, r.Sample) })
+	On(s, &bus.States, func(c StateChange) { client.publishStatus(c.Monitor) })
+	On(s, &bus.Flaps, func(c FlapChange) { client.publishStatus(c.Monitor) })
+	On(s, &bus.Anomalies, func(c AnomalyChange) { client.publishStatus(c.Monitor) })
+	On(s, &bus.Config, func(ConfigChange) { client.publishAllStatus(e) })
+	return nil
+}
+
+// ****************************************************************************
+// stopMQTT()
+// ****************************************************************************
+func stopMQTT() {
+	if mqttClient != nil {
+		mqttClient.Close()
+	}
+}
+
+// ****************************************************************************
+// newMQTTClient()
+// ****************************************************************************
+func newMQTTClient(cfg MQTTConfig) (*MQTTClient, error) {
+	if cfg.Version == 0 {
+		cfg.Version = 4
+	}
+	if cfg.Version != 4 && cfg.Version != 5 {
+		return nil, fmt.Errorf("MQTT version must be 4 (3.1.1) or 5, not %d", cfg.Version)
+	}
+	if cfg.QoS > 1 {
+		return nil, fmt.Errorf("MQTT QoS must be 0 or 1, not %d", cfg.QoS)
+	}
+	if cfg.ClientID == "" {
+		host, _ := os.Hostname()
+		cfg.ClientID = "pingo-" + host
+	}
+	if cfg.StatusTopic == "" {
+		cfg.StatusTopic = DefaultMQTTStatusTopic
+	}
+	if cfg.SampleTopic == "" {
+		cfg.SampleTopic = DefaultMQTTSampleTopic
+	}
+	if cfg.WillTopic == "" {
+		cfg.WillTopic = DefaultMQTTWillTopic
+	}
+
+	u, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("MQTT broker : %w", err)
+	}
+	client := &MQTTClient{
+		config:   cfg,
+		address:  u.Host,
+		queue:    make(chan mqttMessage, MQTTQueue),
+		inflight: make(map[uint16]mqttMessage),
+		retained: make(map[string]bool),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			client.address = net.JoinHostPort(u.Hostname(), "1883")
+		}
+	case "tls", "ssl", "mqtts":
+		if u.Port() == "" {
+			client.address = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		if client.tls, err = mqttTLSConfig(cfg, u.Hostname()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("MQTT broker must be a tcp:// or tls:// URL, not %q", cfg.Broker)
+	}
+	return client, nil
+}
+
+// ****************************************************************************
+// mqttTLSConfig()
+// ****************************************************************************
+func mqttTLSConfig(cfg MQTTConfig, host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: cfg.Insecure}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CACert)
+		}
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ****************************************************************************
+// mqttTopicLevel()
+// ****************************************************************************
+// Makes a value usable inside one topic level, wildcards are not allowed in
+// the topics of published messages
+func mqttTopicLevel(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+}
+
+// ****************************************************************************
+// publish()
+// ****************************************************************************
+func (c *MQTTClient) publish(msg mqttMessage) {
+	for {
+		select {
+		case c.queue <- msg:
+			return
+		default:
+		}
+		// Full, make room by losing the oldest message
+		select {
+		case <-c.queue:
+		default:
+		}
+	}
+}
+
+// ****************************************************************************
+// publishSample()
+// ****************************************************************************
+func (c *MQTTClient) publishSample(m *Monitor, s Sample) {
+	payload, _ := json.Marshal(s)
+	c.publish(mqttMessage{topic: expandFields(c.config.SampleTopic, m, mqttTopicLevel), payload: payload})
+}
+
+// ****************************************************************************
+// publishStatus()
+// ****************************************************************************
+func (c *MQTTClient) publishStatus(m *Monitor) {
+	c.publish(c.statusMessage(m))
+}
+
+// ****************************************************************************
+// statusMessage()
+// ****************************************************************************
+func (c *MQTTClient) statusMessage(m *Monitor) mqttMessage {
+	topic := expandFields(c.config.StatusTopic, m, mqttTopicLevel)
+	payload, _ := json.Marshal(newTargetView(m))
+	c.mu.Lock()
+	c.retained[topic] = true
+	c.mu.Unlock()
+	return mqttMessage{topic: topic, payload: payload, retain: true}
+}
+
+// ****************************************************************************
+// publishAllStatus()
+// ****************************************************************************
+// Publishes the status of every target, and clears the retained status of
+// the targets which are gone
+func (c *MQTTClient) publishAllStatus(e *Engine) {
+	live := make(map[string]bool)
+	for _, m := range e.Monitors() {
+		live[expandFields(c.config.StatusTopic, m, mqttTopicLevel)] = true
+		c.publishStatus(m)
+	}
+	c.mu.Lock()
+	var gone []string
+	for topic := range c.retained {
+		if !live[topic] {
+			gone = append(gone, topic)
+			delete(c.retained, topic)
+		}
+	}
+	c.mu.Unlock()
+	for _, topic := range gone {
+		c.publish(mqttMessage{topic: topic, retain: true}) // An empty retained message clears it
+	}
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+// Keeps a connection to the broker and writes the queued messages to it
+func (c *MQTTClient) run(e *Engine) {
+	defer close(c.done)
+	failing := false
+	for {
+		err := c.connect()
+		if err == nil {
+			if failing {
+				slog.Info("MQTT broker reconnected", "broker", c.address)
+			}
+			failing = false
+			err = c.serve(e)
+		}
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		if !failing {
+			slog.Warn("MQTT broker unavailable, retrying", "broker", c.address, "error", err)
+			failing = true
+		}
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(MQTTRetry * time.Second):
+		}
+	}
+}
+
+// ****************************************************************************
+// connect()
+// ****************************************************************************
+// Opens the connection and waits for the broker to accept the session
+func (c *MQTTClient) connect() error {
+	dialer := &net.Dialer{Timeout: MQTTTimeout * time.Second}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(MQTTTimeout * time.Second))
+	if _, err := conn.Write(c.connectPacket()); err != nil {
+		conn.Close()
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	kind, body, err := readMQTTPacket(reader)
+	if err == nil && (kind != mqttConnAck || len(body) < 2) {
+		err = errors.New("the broker did not acknowledge the connection")
+	}
+	if err == nil && body[1] != 0 {
+		err = fmt.Errorf("connection refused by the broker, reason code %d", body[1])
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn, c.reader = conn, reader
+	c.mu.Unlock()
+	return nil
+}
+
+// ****************************************************************************
+// connectPacket()
+// ****************************************************************************
+func (c *MQTTClient) connectPacket() []byte {
+	cfg := c.config
+	// No clean session, the broker has to keep the state of the messages
+	// sent again after a reconnection
+	flags := 0x04 | 0x20 | cfg.QoS<<3 // Retained will of the same QoS
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, byte(cfg.Version), flags)
+	body = binary.BigEndian.AppendUint16(body, MQTTKeepAlive)
+	if cfg.Version == 5 {
+		body = append(body, 5, 0x11) // Session expiry interval, the default 0 ending the session with the connection
+		body = binary.BigEndian.AppendUint32(body, MQTTSessionExpiry)
+	}
+	body = appendMQTTString(body, cfg.ClientID)
+	if cfg.Version == 5 {
+		body = append(body, 0) // No will properties
+	}
+	body = appendMQTTString(body, cfg.WillTopic)
+	body = appendMQTTString(body, "offline")
+	if cfg.Username != "" {
+		body = appendMQTTString(body, cfg.Username)
+	}
+	if cfg.Password != "" {
+		body = appendMQTTString(body, cfg.Password)
+	}
+	return mqttPacket(mqttConnect, body)
+}
+
+// ****************************************************************************
+// serve()
+// ****************************************************************************
+// Announces pingo and the status of every target, then sends the queue
+// until the connection breaks or the client is closed
+func (c *MQTTClient) serve(e *Engine) error {
+	c.mu.Lock()
+	conn, reader := c.conn, c.reader
+	var resend []mqttMessage // Unacknowledged, sent again with their identifier
+	for _, msg := range c.inflight {
+		resend = append(resend, msg)
+	}
+	c.mu.Unlock()
+	slices.SortFunc(resend, func(a, b mqttMessage) int { return int(a.id) - int(b.id) })
+	defer conn.Close()
+
+	// The reader handles the acknowledgements and notices a broken link
+	broken := make(chan error, 1)
+	pong := make(chan struct{}, 1)
+	acked := make(chan struct{}, 1)
+	go func() {
+		for {
+			kind, body, err := readMQTTPacket(reader)
+			if err != nil {
+				broken <- err
+				return
+			}
+			switch kind {
+			case mqttPubAck:
+				if len(body) >= 2 {
+					c.mu.Lock()
+					delete(c.inflight, binary.BigEndian.Uint16(body))
+					c.mu.Unlock()
+					select {
+					case acked <- struct{}{}:
+					default:
+					}
+				}
+			case mqttPingResp:
+				select {
+				case pong <- struct{}{}:
+				default:
+				}
+			case mqttDisconnect:
+				broken <- errors.New("disconnected by the broker")
+				return
+			}
+		}
+	}()
+
+	resend = append(resend, mqttMessage{topic: c.config.WillTopic, payload: []byte("online"), retain: true})
+	for _, m := range e.Monitors() {
+		resend = append(resend, c.statusMessage(m))
+	}
+	for _, msg := range resend {
+		if err := c.write(msg); err != nil {
+			return err
+		}
+	}
+	keepAlive := time.NewTicker(MQTTKeepAlive * time.Second / 2)
+	defer keepAlive.Stop()
+	waitingPong := false // PINGREQ sent, PINGRESP not received yet
+	for {
+		queue := c.queue
+		if c.windowFull() {
+			queue = nil // Until a PUBACK makes room
+		}
+		select {
+		case <-c.closed:
+			c.goodbye()
+			return nil
+		case err := <-broken:
+			return err
+		case <-pong:
+			waitingPong = false
+		case <-acked:
+		case <-keepAlive.C:
+			if waitingPong {
+				return errors.New("no PINGRESP from the broker")
+			}
+			if err := c.send(mqttPacket(mqttPingReq, nil)); err != nil {
+				return err
+			}
+			waitingPong = true
+		case msg := <-queue:
+			if err := c.write(msg); err != nil {
+				if c.config.QoS == 0 {
+					c.publish(msg) // Sent again once reconnected, as the inflight ones
+				}
+				return err
+			}
+		}
+	}
+}
+
+// ****************************************************************************
+// write()
+// ****************************************************************************
+func (c *MQTTClient) write(msg mqttMessage) error {
+	header := byte(mqttPublish) | c.config.QoS<<1
+	if msg.retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, msg.topic)
+	if c.config.QoS > 0 {
+		c.mu.Lock()
+		if msg.id != 0 {
+			header |= 0x08 // DUP, the broker may have received it already
+		} else {
+			// The next identifier not waiting for its PUBACK, 0 being invalid
+			for range 1 << 16 {
+				c.packetID++
+				if c.packetID != 0 && c.inflight[c.packetID].id == 0 {
+					msg.id = c.packetID
+					break
+				}
+			}
+			if msg.id == 0 {
+				c.mu.Unlock()
+				return errors.New("no MQTT packet identifier left")
+			}
+		}
+		c.inflight[msg.id] = msg
+		c.mu.Unlock()
+		body = binary.BigEndian.AppendUint16(body, msg.id)
+	}
+	if c.config.Version == 5 {
+		body = append(body, 0) // No properties
+	}
+	return c.send(mqttPacket(header, append(body, msg.payload...)))
+}
+
+// ****************************************************************************
+// windowFull()
+// ****************************************************************************
+// Tells whether the queue has to wait for PUBACKs before being sent
+func (c *MQTTClient) windowFull() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.inflight) >= MQTTInflight
+}
+
+// ****************************************************************************
+// send()
+// ****************************************************************************
+func (c *MQTTClient) send(packet []byte) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(MQTTTimeout * time.Second))
+	_, err := conn.Write(packet)
+	return err
+}
+
+// ****************************************************************************
+// goodbye()
+// ****************************************************************************
+// Sends what is still queued, then "offline" since the broker only sends the
+// will when pingo disappears without disconnecting
+func (c *MQTTClient) goodbye() {
+	for len(c.queue) > 0 {
+		if c.write(<-c.queue) != nil {
+			return
+		}
+	}
+	offline := mqttMessage{topic: c.config.WillTopic, payload: []byte("offline"), retain: true}
+	if c.write(offline) == nil {
+		c.send(mqttPacket(mqttDisconnect, nil))
+	}
+}
+
+// ****************************************************************************
+// Close()
+// ****************************************************************************
+// Disconnects from the broker, waiting a little for the goodbye to be sent
+func (c *MQTTClient) Close() {
+	close(c.closed)
+	select {
+	case <-c.done:
+	case <-time.After(MQTTTimeout * time.Second):
+	}
+}
+
+// ****************************************************************************
+// mqttPacket()
+// ****************************************************************************
+// Prepends the fixed header, whose remaining length is a variable integer
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// ****************************************************************************
+// appendMQTTString()
+// ****************************************************************************
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ****************************************************************************
+// readMQTTPacket()
+// ****************************************************************************
+// Returns the packet type and the bytes following the fixed header
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7F) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// testBroker is a stand-in MQTT broker accepting one connection at a time
+type testBroker struct {
+	t        *testing.T
+	listener net.Listener
+	version  int
+}
+
+// testConnect is a CONNECT packet as decoded by the stand-in broker
+type testConnect struct {
+	version     byte
+	flags       byte
+	keepAlive   uint16
+	properties  []byte
+	clientID    string
+	willTopic   string
+	willPayload string
+	username    string
+	password    string
+}
+
+// testPublish is a PUBLISH packet as decoded by the stand-in broker
+type testPublish struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+	dup     bool
+	id      uint16
+}
+
+// ****************************************************************************
+// newTestBroker()
+// ****************************************************************************
+func newTestBroker(t *testing.T, version int) *testBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return &testBroker{t: t, listener: listener, version: version}
+}
+
+// ****************************************************************************
+// client()
+// ****************************************************************************
+func (b *testBroker) client(cfg MQTTConfig) *MQTTClient {
+	b.t.Helper()
+	cfg.Broker = "tcp://" + b.listener.Addr().String()
+	cfg.Version = b.version
+	client, err := newMQTTClient(cfg)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return client
+}
+
+// ****************************************************************************
+// accept()
+// ****************************************************************************
+// Accepts a connection, checks its CONNECT and acknowledges it
+func (b *testBroker) accept() (net.Conn, *bufio.Reader, testConnect) {
+	b.t.Helper()
+	conn, err := b.listener.Accept()
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	b.t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	header, body := b.read(reader)
+	if header&0xF0 != mqttConnect {
+		b.t.Fatalf("first packet 0x%02X, want CONNECT", header)
+	}
+
+	var c testConnect
+	d := testDecoder{body: body}
+	if name := d.string(); name != "MQTT" {
+		b.t.Fatalf("protocol name %q", name)
+	}
+	c.version, c.flags = d.byte(), d.byte()
+	c.keepAlive = d.uint16()
+	if c.version == 5 {
+		c.properties = d.properties()
+	}
+	c.clientID = d.string()
+	if c.flags&0x04 != 0 {
+		if c.version == 5 && len(d.properties()) != 0 {
+			b.t.Errorf("will properties")
+		}
+		c.willTopic, c.willPayload = d.string(), d.string()
+	}
+	if c.flags&0x80 != 0 {
+		c.username = d.string()
+	}
+	if c.flags&0x40 != 0 {
+		c.password = d.string()
+	}
+	if d.err || len(d.body) != 0 {
+		b.t.Fatalf("malformed CONNECT %v", body)
+	}
+
+	ack := []byte{0, 0} // Session present, return code
+	if c.version == 5 {
+		ack = append(ack, 0) // No properties
+	}
+	conn.Write(mqttPacket(mqttConnAck, ack))
+	return conn, reader, c
+}
+
+// ****************************************************************************
+// read()
+// ****************************************************************************
+// Returns the whole first byte of the fixed header, flags included
+func (b *testBroker) read(reader *bufio.Reader) (byte, []byte) {
+	b.t.Helper()
+	first, err := reader.Peek(1)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	header := first[0]
+	_, body, err := readMQTTPacket(reader)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return header, body
+}
+
+// ****************************************************************************
+// publish()
+// ****************************************************************************
+// Reads the next PUBLISH, acknowledging it when ack is set
+func (b *testBroker) publish(conn net.Conn, reader *bufio.Reader, ack bool) testPublish {
+	b.t.Helper()
+	for {
+		header, body := b.read(reader)
+		if header&0xF0 == mqttPingReq {
+			conn.Write(mqttPacket(mqttPingResp, nil))
+			continue
+		}
+		if header&0xF0 != mqttPublish {
+			b.t.Fatalf("packet 0x%02X, want PUBLISH", header)
+		}
+		p := testPublish{qos: header >> 1 & 0x03, retain: header&0x01 != 0, dup: header&0x08 != 0}
+		d := testDecoder{body: body}
+		p.topic = d.string()
+		if p.qos > 0 {
+			p.id = d.uint16()
+		}
+		if b.version == 5 && len(d.properties()) != 0 {
+			b.t.Errorf("PUBLISH properties")
+		}
+		if d.err {
+			b.t.Fatalf("malformed PUBLISH %v", body)
+		}
+		p.payload = string(d.body)
+		if ack && p.qos > 0 {
+			conn.Write(mqttPacket(mqttPubAck, binary.BigEndian.AppendUint16(nil, p.id)))
+		}
+		return p
+	}
+}
+
+// testDecoder reads the fields of a packet body, err being set when it is
+// too short
+type testDecoder struct {
+	body []byte
+	err  bool
+}
+
+func (d *testDecoder) byte() byte {
+	if len(d.body) < 1 {
+		d.err = true
+		return 0
+	}
+	v := d.body[0]
+	d.body = d.body[1:]
+	return v
+}
+
+func (d *testDecoder) uint16() uint16 {
+	if len(d.body) < 2 {
+		d.err = true
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.body)
+	d.body = d.body[2:]
+	return v
+}
+
+func (d *testDecoder) string() string {
+	n := int(d.uint16())
+	if len(d.body) < n {
+		d.err = true
+		return ""
+	}
+	v := string(d.body[:n])
+	d.body = d.body[n:]
+	return v
+}
+
+// properties returns the MQTT 5 properties, shorter than 128 bytes
+func (d *testDecoder) properties() []byte {
+	n := int(d.byte())
+	if n > 127 || len(d.body) < n {
+		d.err = true
+		return nil
+	}
+	v := d.body[:n]
+	d.body = d.body[n:]
+	return v
+}
+
+// ****************************************************************************
+// newTestMQTTEngine()
+// ****************************************************************************
+func newTestMQTTEngine() *Engine {
+	e := NewEngine(time.Second)
+	e.Add(TargetConfig{Address: "192.0.2.1", Name: "gateway"})
+	return e
+}
+
+// ****************************************************************************
+// TestMQTTSession()
+// ****************************************************************************
+// Connects with both versions, then checks the announce, the retained status
+// and the goodbye
+func TestMQTTSession(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		broker := newTestBroker(t, version)
+		client := broker.client(MQTTConfig{ClientID: "pingo-test", Username: "user", Password: "secret", QoS: 1})
+		e := newTestMQTTEngine()
+		go client.run(e)
+
+		conn, reader, c := broker.accept()
+		switch {
+		case int(c.version) != version:
+			t.Errorf("v%d : protocol level %d", version, c.version)
+		case c.flags != 0x04|0x08|0x20|0x40|0x80:
+			t.Errorf("v%d : connect flags 0x%02X", version, c.flags)
+		case version == 5 && string(c.properties) != string([]byte{0x11, 0, 0, MQTTSessionExpiry >> 8, MQTTSessionExpiry & 0xFF}):
+			t.Errorf("v%d : connect properties %v", version, c.properties)
+		case c.keepAlive != MQTTKeepAlive || c.clientID != "pingo-test":
+			t.Errorf("v%d : keep alive %d, client %q", version, c.keepAlive, c.clientID)
+		case c.willTopic != DefaultMQTTWillTopic || c.willPayload != "offline":
+			t.Errorf("v%d : will %q %q", version, c.willTopic, c.willPayload)
+		case c.username != "user" || c.password != "secret":
+			t.Errorf("v%d : credentials %q %q", version, c.username, c.password)
+		}
+
+		online := broker.publish(conn, reader, true)
+		if online.topic != DefaultMQTTWillTopic || online.payload != "online" || !online.retain || online.qos != 1 {
+			t.Errorf("v%d : announce %+v", version, online)
+		}
+		status := broker.publish(conn, reader, true)
+		if status.topic != "pingo/192.0.2.1/status" || !status.retain {
+			t.Errorf("v%d : status %+v", version, status)
+		}
+
+		client.publishSample(e.Find("192.0.2.1"), Sample{Time: time.Now(), RTT: 12.5})
+		sample := broker.publish(conn, reader, true)
+		if sample.topic != "pingo/192.0.2.1/sample" || sample.retain {
+			t.Errorf("v%d : sample %+v", version, sample)
+		}
+
+		go client.Close()
+		offline := broker.publish(conn, reader, true)
+		if offline.topic != DefaultMQTTWillTopic || offline.payload != "offline" || !offline.retain {
+			t.Errorf("v%d : goodbye %+v", version, offline)
+		}
+		if header, _ := broker.read(reader); header != mqttDisconnect {
+			t.Errorf("v%d : packet 0x%02X after the goodbye, want DISCONNECT", version, header)
+		}
+		<-client.done
+	}
+}
+
+// ****************************************************************************
+// TestMQTTResend()
+// ****************************************************************************
+// Messages left without PUBACK are sent again after a reconnection, with
+// their identifier and the DUP flag
+func TestMQTTResend(t *testing.T) {
+	broker := newTestBroker(t, 4)
+	client := broker.client(MQTTConfig{QoS: 1})
+	e := newTestMQTTEngine()
+	served := make(chan error)
+	serve := func() {
+		if err := client.connect(); err != nil {
+			served <- err
+			return
+		}
+		served <- client.serve(e)
+	}
+
+	go serve()
+	conn, reader, _ := broker.accept()
+	online := broker.publish(conn, reader, false)
+	broker.publish(conn, reader, true) // Status
+	if online.dup || online.id == 0 {
+		t.Fatalf("first announce %+v", online)
+	}
+	conn.Close()
+	if err := <-served; err == nil {
+		t.Fatal("serve() ended without error on a broken connection")
+	}
+
+	go serve()
+	conn, reader, _ = broker.accept()
+	again := broker.publish(conn, reader, true)
+	if !again.dup || again.id != online.id || again.payload != "online" {
+		t.Errorf("resent %+v, want a DUP of %+v", again, online)
+	}
+	for _, p := range []testPublish{broker.publish(conn, reader, true), broker.publish(conn, reader, true)} {
+		if p.dup || p.id == online.id {
+			t.Errorf("new publish %+v", p)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.mu.Lock()
+		pending := len(client.inflight)
+		client.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages still waiting for PUBACK", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(client.closed)
+	broker.publish(conn, reader, true) // Goodbye
+	<-served
+}
+
+// ****************************************************************************
+// TestMQTTInflight()
+// ****************************************************************************
+// No more than MQTTInflight messages wait for their PUBACK, the next ones
+// being sent as the acknowledgements come
+func TestMQTTInflight(t *testing.T) {
+	broker := newTestBroker(t, 4)
+	client := broker.client(MQTTConfig{QoS: 1})
+	e := newTestMQTTEngine()
+	go client.run(e)
+	conn, reader, _ := broker.accept()
+	broker.publish(conn, reader, true) // Announce
+	broker.publish(conn, reader, true) // Status
+
+	for range MQTTInflight + 1 {
+		client.publishSample(e.Find("192.0.2.1"), Sample{Time: time.Now(), RTT: 1})
+	}
+	var first testPublish
+	for idx := range MQTTInflight {
+		p := broker.publish(conn, reader, false)
+		if idx == 0 {
+			first = p
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := reader.Peek(1); err == nil {
+		t.Fatal("message sent beyond the inflight window")
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(mqttPacket(mqttPubAck, binary.BigEndian.AppendUint16(nil, first.id)))
+	if last := broker.publish(conn, reader, false); last.dup || last.topic != "pingo/192.0.2.1/sample" {
+		t.Errorf("publish after the PUBACK %+v", last)
+	}
+
+	// Every identifier taken, write() has to give up instead of looping
+	client.mu.Lock()
+	for id := range 1 << 16 {
+		client.inflight[uint16(id)] = mqttMessage{id: uint16(id)}
+	}
+	client.mu.Unlock()
+	if err := client.write(mqttMessage{topic: "pingo/test"}); err == nil {
+		t.Error("write() without a free packet identifier")
+	}
+	client.mu.Lock()
+	clear(client.inflight)
+	client.mu.Unlock()
+	go client.Close()
+	broker.publish(conn, reader, true) // Goodbye
+	<-client.done
+}
@@ -0,0 +1,414 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// OTLPConfig describes the OpenTelemetry collector the metrics are pushed to
+type OTLPConfig struct {
+	Enabled    bool              `json:"enabled"`
+	Protocol   string            `json:"protocol"`             // "http/protobuf" (default) or "grpc"
+	Endpoint   string            `json:"endpoint,omitempty"`   // e.g. http://localhost:4318 or http://localhost:4317
+	Headers    map[string]string `json:"headers,omitempty"`    // e.g. an authorization header
+	Interval   int               `json:"interval,omitempty"`   // Seconds between two exports
+	Attributes map[string]string `json:"attributes,omitempty"` // Added to the resource attributes
+}
+
+// OTLPExporter pushes the cumulative metrics of metrics.go, nothing is lost
+// while the collector is unreachable since the next export has it all
+type OTLPExporter struct {
+	config   OTLPConfig
+	url      string
+	client   *http.Client
+	resource []protoMessage // Resource attributes
+	engine   *Engine
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// protoBuffer encodes the few protobuf wire types OTLP needs
+type protoBuffer []byte
+
+type protoMessage = func(b *protoBuffer)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var otlpExporter *OTLPExporter
+
+// ****************************************************************************
+// startOTLP()
+// ****************************************************************************
+func startOTLP(e *Engine, cfg OTLPConfig) error {
+	exporter, err := newOTLPExporter(e, cfg)
+	if err != nil {
+		return err
+	}
+	otlpExporter = exporter
+	go exporter.run()
+	return nil
+}
+
+// ****************************************************************************
+// stopOTLP()
+// ****************************************************************************
+// Sends a last export so that the final counts are not lost
+func stopOTLP() {
+	if otlpExporter != nil {
+		close(otlpExporter.stop)
+		<-otlpExporter.done
+	}
+}
+
+// ****************************************************************************
+// newOTLPExporter()
+// ****************************************************************************
+func newOTLPExporter(e *Engine, cfg OTLPConfig) (*OTLPExporter, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultOTLPInterval
+	}
+	exporter := &OTLPExporter{config: cfg, engine: e, stop: make(chan struct{}), done: make(chan struct{})}
+
+	switch cfg.Protocol {
+	case "", "http/protobuf":
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = DefaultOTLPHTTPEndpoint
+		}
+		exporter.client = &http.Client{Timeout: OTLPTimeout * time.Second}
+	case "grpc":
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = DefaultOTLPGRPCEndpoint
+		}
+		// gRPC runs over HTTP/2, in clear text for http:// endpoints
+		var protocols http.Protocols
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		exporter.client = &http.Client{
+			Timeout:   OTLPTimeout * time.Second,
+			Transport: &http.Transport{Protocols: &protocols},
+		}
+	default:
+		return nil, fmt.Errorf("OTLP protocol must be http/protobuf or grpc, not %q", cfg.Protocol)
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("OTLP endpoint must be a http:// or https:// URL, not %q", cfg.Endpoint)
+	}
+	switch {
+	case cfg.Protocol == "grpc":
+		u.Path = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	case u.Path == "" || u.Path == "/":
+		u.Path = "/v1/metrics"
+	}
+	exporter.url = u.String()
+
+	// Resource attributes identifying this pingo
+	host, _ := os.Hostname()
+	attributes := map[string]string{
+		"service.name":        AppTitle,
+		"service.version":     GetDisplayVersion(),
+		"service.instance.id": fmt.Sprintf("%s-%d", host, os.Getpid()),
+		"host.name":           host,
+	}
+	for key, value := range cfg.Attributes {
+		attributes[key] = value
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		exporter.resource = append(exporter.resource, otlpAttribute(key, attributes[key]))
+	}
+	return exporter, nil
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+func (x *OTLPExporter) run() {
+	defer close(x.done)
+	ticker := time.NewTicker(time.Duration(x.config.Interval) * time.Second)
+	defer ticker.Stop()
+	failing := false
+	for {
+		stopping := false
+		select {
+		case <-ticker.C:
+		case <-x.stop:
+			stopping = true
+		}
+
+		err := x.export()
+		if err != nil && !failing {
+			slog.Warn("OTLP export failing, retrying", "endpoint", x.url, "error", err)
+		} else if err == nil && failing {
+			slog.Info("OTLP export recovered", "endpoint", x.url)
+		}
+		failing = err != nil
+		if stopping {
+			return
+		}
+	}
+}
+
+// ****************************************************************************
+// export()
+// ****************************************************************************
+func (x *OTLPExporter) export() error {
+	body := x.request(time.Now())
+	if x.config.Protocol == "grpc" {
+		// Length-prefixed message, uncompressed
+		framed := make([]byte, 5, 5+len(body))
+		binary.BigEndian.PutUint32(framed[1:], uint32(len(body)))
+		body = append(framed, body...)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, x.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range x.config.Headers {
+		req.Header.Set(key, value)
+	}
+	if x.config.Protocol == "grpc" {
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // The gRPC trailers follow the body
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if x.config.Protocol == "grpc" {
+		// The status is in the trailers, or in the headers when there is no body
+		status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+		if status == "" {
+			status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+		}
+		if status != "0" {
+			return fmt.Errorf("gRPC status %s %s", status, message)
+		}
+	}
+	return nil
+}
+
+// ****************************************************************************
+// request()
+// ****************************************************************************
+// Encodes an ExportMetricsServiceRequest with the availability, probe and
+// loss counters and the RTT histogram of every target
+func (x *OTLPExporter) request(now time.Time) []byte {
+	monitors := x.engine.Monitors()
+	end := uint64(now.UnixNano())
+
+	up := make([]protoMessage, 0, len(monitors))
+	for _, m := range monitors {
+		value := 0.0
+		if m.Stats().State == StateUp {
+			value = 1
+		}
+		up = append(up, otlpNumberPoint(m, 0, end, value))
+	}
+
+	metricsMutex.Lock()
+	forgetDeletedMetrics(monitors)
+	var probes, lost, rtt []protoMessage
+	for _, m := range monitors {
+		tm, ok := metricsByTarget[m.Config.Address]
+		if !ok {
+			continue
+		}
+		start := uint64(tm.start.UnixNano())
+		probes = append(probes, otlpCounterPoint(m, start, end, tm.probes))
+		lost = append(lost, otlpCounterPoint(m, start, end, tm.lost))
+		rtt = append(rtt, otlpHistogramPoint(m, start, end, *tm))
+	}
+	metricsMutex.Unlock()
+
+	var b protoBuffer
+	b.message(1, func(b *protoBuffer) { // ResourceMetrics
+		b.message(1, func(b *protoBuffer) { // Resource
+			for _, attribute := range x.resource {
+				b.message(1, attribute)
+			}
+		})
+		b.message(2, func(b *protoBuffer) { // ScopeMetrics
+			b.message(1, func(b *protoBuffer) { // InstrumentationScope
+				b.string(1, AppID)
+				b.string(2, GetDisplayVersion())
+			})
+			b.message(2, otlpMetric("pingo.up", "Whether the target answers (1) or not (0).", "1", 5, up, false))
+			b.message(2, otlpMetric("pingo.probes", "Probes sent to the target.", "{probe}", 7, probes, true))
+			b.message(2, otlpMetric("pingo.probes.lost", "Probes left without answer.", "{probe}", 7, lost, true))
+			b.message(2, otlpMetric("pingo.rtt", "Round trip time of the answered probes.", "s", 9, rtt, false))
+		})
+	})
+	return b
+}
+
+// ****************************************************************************
+// otlpMetric()
+// ****************************************************************************
+// kind is the field of the Metric data : 5 gauge, 7 sum, 9 histogram
+func otlpMetric(name, description, unit string, kind int, points []protoMessage, monotonic bool) protoMessage {
+	return func(b *protoBuffer) {
+		b.string(1, name)
+		b.string(2, description)
+		b.string(3, unit)
+		b.message(kind, func(b *protoBuffer) {
+			for _, point := range points {
+				b.message(1, point)
+			}
+			if kind != 5 {
+				b.varint(2, 2) // Cumulative temporality
+			}
+			if monotonic {
+				b.varint(3, 1)
+			}
+		})
+	}
+}
+
+// ****************************************************************************
+// otlpNumberPoint()
+// ****************************************************************************
+func otlpNumberPoint(m *Monitor, start, end uint64, value float64) protoMessage {
+	return otlpPoint(m, start, end, func(b *protoBuffer) { b.fixed64(4, math.Float64bits(value)) })
+}
+
+// ****************************************************************************
+// otlpCounterPoint()
+// ****************************************************************************
+func otlpCounterPoint(m *Monitor, start, end uint64, value uint64) protoMessage {
+	return otlpPoint(m, start, end, func(b *protoBuffer) { b.fixed64(6, value) })
+}
+
+// ****************************************************************************
+// otlpPoint()
+// ****************************************************************************
+// Encodes a NumberDataPoint, start being 0 for gauges
+func otlpPoint(m *Monitor, start, end uint64, value protoMessage) protoMessage {
+	return func(b *protoBuffer) {
+		if start > 0 {
+			b.fixed64(2, start)
+		}
+		b.fixed64(3, end)
+		value(b)
+		for _, attribute := range otlpTargetAttributes(m) {
+			b.message(7, attribute)
+		}
+	}
+}
+
+// ****************************************************************************
+// otlpHistogramPoint()
+// ****************************************************************************
+// The Prometheus buckets are cumulative, OTLP ones are not
+func otlpHistogramPoint(m *Monitor, start, end uint64, tm targetMetrics) protoMessage {
+	return func(b *protoBuffer) {
+		b.fixed64(2, start)
+		b.fixed64(3, end)
+		answered := tm.probes - tm.lost
+		b.fixed64(4, answered)
+		b.fixed64(5, math.Float64bits(tm.sum))
+		var counts, bounds protoBuffer
+		previous := uint64(0)
+		for idx, bound := range MetricsBuckets {
+			counts = binary.LittleEndian.AppendUint64(counts, tm.buckets[idx]-previous)
+			bounds = binary.LittleEndian.AppendUint64(bounds, math.Float64bits(bound))
+			previous = tm.buckets[idx]
+		}
+		counts = binary.LittleEndian.AppendUint64(counts, answered-previous) // Above the last bound
+		b.bytes(6, counts)
+		b.bytes(7, bounds)
+		for _, attribute := range otlpTargetAttributes(m) {
+			b.message(9, attribute)
+		}
+	}
+}
+
+// ****************************************************************************
+// otlpTargetAttributes()
+// ****************************************************************************
+// Same names as the Prometheus labels
+func otlpTargetAttributes(m *Monitor) []protoMessage {
+	attributes := []protoMessage{
+		otlpAttribute("name", m.DisplayName()),
+		otlpAttribute("address", m.Config.Address),
+		otlpAttribute("probe", ProbeTypeICMP),
+	}
+	if m.Config.Group != "" {
+		attributes = append(attributes, otlpAttribute("group", m.Config.Group))
+	}
+	return attributes
+}
+
+// ****************************************************************************
+// otlpAttribute()
+// ****************************************************************************
+// Encodes a KeyValue holding a string
+func otlpAttribute(key, value string) protoMessage {
+	return func(b *protoBuffer) {
+		b.string(1, key)
+		b.message(2, func(b *protoBuffer) { b.string(1, value) })
+	}
+}
+
+// ****************************************************************************
+// protoBuffer
+// ****************************************************************************
+func (b *protoBuffer) tag(field, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field<<3|wireType))
+}
+
+func (b *protoBuffer) varint(field int, value uint64) {
+	b.tag(field, 0)
+	*b = binary.AppendUvarint(*b, value)
+}
+
+func (b *protoBuffer) fixed64(field int, value uint64) {
+	b.tag(field, 1)
+	*b = binary.LittleEndian.AppendUint64(*b, value)
+}
+
+func (b *protoBuffer) bytes(field int, value []byte) {
+	b.tag(field, 2)
+	*b = binary.AppendUvarint(*b, uint64(len(value)))
+	*b = append(*b, value...)
+}
+
+func (b *protoBuffer) string(field int, value string) {
+	b.bytes(field, []byte(value))
+}
+
+func (b *protoBuffer) message(field int, encode protoMessage) {
+	var inner protoBuffer
+	encode(&inner)
+	b.bytes(field, inner)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// protoFields holds the decoded fields of a protobuf message, the varint and
+// fixed64 values as 8 little endian bytes
+type protoFields map[int][][]byte
+
+// ****************************************************************************
+// decodeProto()
+// ****************************************************************************
+func decodeProto(t *testing.T, b []byte) protoFields {
+	t.Helper()
+	fields := make(protoFields)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad tag in %v", b)
+		}
+		b = b[n:]
+		var value []byte
+		switch key & 0x07 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint in %v", b)
+			}
+			value, b = binary.LittleEndian.AppendUint64(nil, v), b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 in %v", b)
+			}
+			value, b = b[:8], b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				t.Fatalf("bad length in %v", b)
+			}
+			value, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("wire type %d", key&0x07)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
+
+func (f protoFields) uint(field int) uint64 {
+	if len(f[field]) == 0 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(f[field][0])
+}
+
+func (f protoFields) string(field int) string {
+	if len(f[field]) == 0 {
+		return ""
+	}
+	return string(f[field][0])
+}
+
+// ****************************************************************************
+// protoAttributes()
+// ****************************************************************************
+// Decodes the KeyValue list of a field, the values being strings
+func protoAttributes(t *testing.T, values [][]byte) map[string]string {
+	attributes := make(map[string]string)
+	for _, value := range values {
+		kv := decodeProto(t, value)
+		attributes[kv.string(1)] = decodeProto(t, kv[2][0]).string(1)
+	}
+	return attributes
+}
+
+// ****************************************************************************
+// newTestCollector()
+// ****************************************************************************
+// Serves a collector speaking OTLP over HTTP, or gRPC over h2c, which
+// forwards the requests it receives
+func newTestCollector(t *testing.T, grpc bool) (*httptest.Server, chan []byte) {
+	requests := make(chan []byte, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !grpc {
+			if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+				t.Errorf("HTTP request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+			}
+			requests <- body
+			return
+		}
+
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc" ||
+			r.URL.Path != "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export" {
+			t.Errorf("gRPC request %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+			t.Errorf("bad gRPC frame %v", body)
+		} else {
+			requests <- body[5:]
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte{0, 0, 0, 0, 0}) // Empty ExportMetricsServiceResponse
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	if grpc {
+		server.Config.Protocols = new(http.Protocols)
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// ****************************************************************************
+// TestOTLPExport()
+// ****************************************************************************
+// Exports the counters of a target edited meanwhile, both protocols having
+// to carry the same request
+func TestOTLPExport(t *testing.T) {
+	metricsMutex.Lock()
+	metricsByTarget = make(map[string]*targetMetrics)
+	metricsMutex.Unlock()
+	e := NewEngine(time.Second)
+	m := e.Add(TargetConfig{Address: "192.0.2.1", Name: "gateway"})
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	recordMetrics(m, Sample{Time: start, RTT: 12})
+	recordMetrics(m, Sample{Time: start.Add(time.Second), Lost: true})
+	m = e.Update("192.0.2.1", TargetConfig{Address: "192.0.2.1", Name: "router"})
+	recordMetrics(m, Sample{Time: start.Add(2 * time.Second), RTT: 3})
+
+	for _, protocol := range []string{"http/protobuf", "grpc"} {
+		server, requests := newTestCollector(t, protocol == "grpc")
+		exporter, err := newOTLPExporter(e, OTLPConfig{Protocol: protocol, Endpoint: server.URL, Attributes: map[string]string{"site": "lab"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exporter.export(); err != nil {
+			t.Fatalf("%s : %v", protocol, err)
+		}
+
+		request := decodeProto(t, <-requests)
+		resourceMetrics := decodeProto(t, request[1][0])
+		resource := protoAttributes(t, decodeProto(t, resourceMetrics[1][0])[1])
+		if resource["service.name"] != AppTitle || resource["site"] != "lab" {
+			t.Errorf("%s : resource %v", protocol, resource)
+		}
+		metrics := make(map[string]protoFields)
+		for _, value := range decodeProto(t, resourceMetrics[2][0])[2] {
+			metric := decodeProto(t, value)
+			metrics[metric.string(1)] = metric
+		}
+
+		probes := decodeProto(t, decodeProto(t, metrics["pingo.probes"][7][0])[1][0])
+		attributes := protoAttributes(t, probes[7])
+		switch {
+		case probes.uint(6) != 3:
+			t.Errorf("%s : %d probes, want 3", protocol, probes.uint(6))
+		case probes.uint(2) != uint64(start.UnixNano()):
+			t.Errorf("%s : counters started at %d, want %d", protocol, probes.uint(2), start.UnixNano())
+		case attributes["name"] != "router" || attributes["address"] != "192.0.2.1":
+			t.Errorf("%s : target %v", protocol, attributes)
+		}
+		if lost := decodeProto(t, decodeProto(t, metrics["pingo.probes.lost"][7][0])[1][0]); lost.uint(6) != 1 {
+			t.Errorf("%s : %d lost, want 1", protocol, lost.uint(6))
+		}
+		up := decodeProto(t, decodeProto(t, metrics["pingo.up"][5][0])[1][0])
+		if len(up[2]) != 0 || math.Float64frombits(up.uint(4)) != 0 {
+			t.Errorf("%s : up gauge %v", protocol, up)
+		}
+
+		rtt := decodeProto(t, decodeProto(t, metrics["pingo.rtt"][9][0])[1][0])
+		if rtt.uint(4) != 2 || math.Abs(math.Float64frombits(rtt.uint(5))-0.015) > 1e-9 {
+			t.Errorf("%s : rtt count %d, sum %v", protocol, rtt.uint(4), math.Float64frombits(rtt.uint(5)))
+		}
+		counts := rtt[6][0]
+		if len(counts) != 8*(len(MetricsBuckets)+1) || len(rtt[7][0]) != 8*len(MetricsBuckets) {
+			t.Fatalf("%s : %d counts for %d bounds", protocol, len(counts)/8, len(rtt[7][0])/8)
+		}
+		total := uint64(0)
+		for idx := range len(MetricsBuckets) + 1 {
+			total += binary.LittleEndian.Uint64(counts[8*idx:])
+		}
+		if total != 2 || binary.LittleEndian.Uint64(counts[8*3:]) != 1 || binary.LittleEndian.Uint64(counts[8*5:]) != 1 {
+			t.Errorf("%s : bucket counts %v", protocol, counts)
+		}
+	}
+}
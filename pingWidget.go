@@ -4,60 +4,71 @@ package main
 // IMPORTS
 // ****************************************************************************
 import (
-	"fmt"
-
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 )
 
 // ****************************************************************************
 // TYPES
 // ****************************************************************************
+// PingWidget is a row of the targets table, bound to the monitor it shows as
+// the table scrolls. Its cells follow shownColumns.
 type PingWidget struct {
 	widget.BaseWidget
-	lblLost         *ColoredLabel
-	lblHostname     *ColoredLabel
-	lblAddress      *ColoredLabel
-	lblPingValue    *ColoredLabel
-	lblAverageValue *ColoredLabel
-	lblMinValue     *ColoredLabel
-	lblMaxValue     *ColoredLabel
-	lblRequests     *ColoredLabel
-	btnDelete       *SlimButton
+	monitor    *Monitor                 // nil until bound
+	cells      map[string]*ColoredLabel // By column key
+	actions    *fyne.Container
+	content    *fyne.Container
+	version    int // columnsVersion the cells were laid out for
+	btnPause   *SlimButton
+	btnSilence *SlimButton
+	btnDelete  *SlimButton
 }
 
+// PingHeaderWidget shows the titles of shownColumns, sorts on a click and
+// resizes the columns when their separators are dragged
 type PingHeaderWidget struct {
 	widget.BaseWidget
-	lblLost         *ColoredLabel
-	lblHostname     *ColoredLabel
-	lblAddress      *ColoredLabel
-	lblPingValue    *ColoredLabel
-	lblAverageValue *ColoredLabel
-	lblMinValue     *ColoredLabel
-	lblMaxValue     *ColoredLabel
-	lblRequests     *ColoredLabel
-	lblDelete       *ColoredLabel
+	titles  map[string]*ColoredLabel // By column key
+	boxes   map[string]fyne.CanvasObject
+	content *fyne.Container
+	version int
+	OnSort  func(column string) // Called with the key of the clicked column
 }
 
 // ****************************************************************************
 // NewPingWidget()
 // ****************************************************************************
-func NewPingWidget(addressIP string) *PingWidget {
+func NewPingWidget(onDelete func(m *Monitor)) *PingWidget {
 	item := &PingWidget{
-		lblLost:         NewColoredLabel("-", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblHostname:     NewColoredLabel("unknown", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblAddress:      NewColoredLabel(addressIP, ColorLightBlue, 11, fyne.TextAlignCenter, false),
-		lblPingValue:    NewColoredLabel("0", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblAverageValue: NewColoredLabel("0", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblMinValue:     NewColoredLabel("0", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblMaxValue:     NewColoredLabel("0", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		lblRequests:     NewColoredLabel("0", ColorLightGrey, 11, fyne.TextAlignCenter, false),
-		btnDelete:       NewSlimButton("Delete", func() { fmt.Printf("Hello") }),
+		cells:   make(map[string]*ColoredLabel),
+		content: container.New(&columnLayout{}),
+		version: -1,
+	}
+	for _, column := range tableColumns {
+		if column.Cell != nil {
+			item.cells[column.Key] = NewColoredLabel("-", ColorLightGrey, 11, fyne.TextAlignCenter, false)
+		}
 	}
+	item.btnPause = NewSlimButton("Pause", func() {
+		if item.monitor != nil {
+			toggleTargetPause(item.monitor)
+		}
+	})
+	item.btnSilence = NewSlimButton("Mute", item.toggleSilence)
+	item.btnDelete = NewSlimButton("Delete", func() {
+		if item.monitor != nil {
+			onDelete(item.monitor)
+		}
+	})
+	item.btnPause.OnTappedSecondary = item.TappedSecondary
+	item.btnSilence.OnTappedSecondary = item.TappedSecondary
+	item.btnDelete.OnTappedSecondary = item.TappedSecondary
+	item.actions = container.NewGridWithColumns(3, item.btnPause, item.btnSilence, item.btnDelete)
 
 	item.ExtendBaseWidget(item) // Critical for Fyne to recognize it as a widget
+	item.layoutCells()
 	return item
 }
 
@@ -65,10 +76,100 @@ func NewPingWidget(addressIP string) *PingWidget {
 // CreateRenderer()
 // ****************************************************************************
 func (i *PingWidget) CreateRenderer() fyne.WidgetRenderer {
-	// We use a container to handle the layout of our internal components
-	content := container.NewGridWithRows(1, i.lblHostname, i.lblAddress, layout.NewSpacer(), i.lblLost, layout.NewSpacer(), i.lblPingValue, i.lblAverageValue, i.lblMinValue, i.lblMaxValue, i.lblRequests, i.btnDelete)
+	return widget.NewSimpleRenderer(i.content)
+}
+
+// ****************************************************************************
+// layoutCells()
+// ****************************************************************************
+// Puts the cells of the visible columns in the row, in their order
+func (i *PingWidget) layoutCells() {
+	var objects []fyne.CanvasObject
+	for _, c := range shownColumns {
+		if c.Key == "action" {
+			objects = append(objects, i.actions)
+		} else {
+			objects = append(objects, i.cells[c.Key])
+		}
+	}
+	i.content.Objects = objects
+	i.content.Refresh()
+	i.version = columnsVersion
+}
+
+// ****************************************************************************
+// Bind()
+// ****************************************************************************
+// Makes the row show another monitor, must be called on the Fyne thread
+func (i *PingWidget) Bind(m *Monitor) {
+	i.monitor = m
+	i.Update()
+}
 
-	return widget.NewSimpleRenderer(content)
+// ****************************************************************************
+// Update()
+// ****************************************************************************
+// Refreshes the cells from the monitor, must be called on the Fyne thread
+func (i *PingWidget) Update() {
+	if i.version != columnsVersion {
+		i.layoutCells()
+	}
+	if i.monitor == nil {
+		return
+	}
+	stats := i.monitor.Stats()
+	bold := i.monitor.Config.Address == detailAddress()
+	for _, c := range shownColumns {
+		column, _ := findColumn(c.Key)
+		if column.Cell == nil {
+			continue
+		}
+		text, bg := column.Cell(i.monitor, stats)
+		cell := i.cells[c.Key]
+		cell.SetText(text)
+		cell.SetColor(bg)
+		if cell.Bold != bold {
+			cell.SetBold(bold)
+		}
+	}
+
+	pause := "Pause"
+	if i.monitor.Config.Paused {
+		pause = "Resume"
+	}
+	if i.btnPause.Text != pause {
+		i.btnPause.Text = pause
+		i.btnPause.Refresh()
+	}
+	text := "Mute"
+	if _, ok := silencedUntil(i.monitor.Config.Address); ok {
+		text = "Unmute"
+	}
+	if i.btnSilence.Text != text {
+		i.btnSilence.Text = text
+		i.btnSilence.Refresh()
+	}
+}
+
+// ****************************************************************************
+// toggleSilence()
+// ****************************************************************************
+func (i *PingWidget) toggleSilence() {
+	if i.monitor == nil {
+		return
+	}
+	toggleTargetSilence(i.monitor)
+	i.Update()
+}
+
+// ****************************************************************************
+// TappedSecondary()
+// ****************************************************************************
+// Opens the menu of the target under the mouse
+func (i *PingWidget) TappedSecondary(ev *fyne.PointEvent) {
+	if i.monitor != nil {
+		showTargetMenu(i.monitor, ev.AbsolutePosition)
+	}
 }
 
 // ****************************************************************************
@@ -76,18 +177,27 @@ func (i *PingWidget) CreateRenderer() fyne.WidgetRenderer {
 // ****************************************************************************
 func NewPingHeaderWidget() *PingHeaderWidget {
 	item := &PingHeaderWidget{
-		lblLost:         NewColoredLabel("Lost", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblHostname:     NewColoredLabel("Hostname", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblAddress:      NewColoredLabel("Address", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblPingValue:    NewColoredLabel("Ping", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblAverageValue: NewColoredLabel("Average", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblMinValue:     NewColoredLabel("Min", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblMaxValue:     NewColoredLabel("Max", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblRequests:     NewColoredLabel("Requests", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
-		lblDelete:       NewColoredLabel("Action", ColorDarkGrey, 11, fyne.TextAlignCenter, true),
+		titles:  make(map[string]*ColoredLabel),
+		boxes:   make(map[string]fyne.CanvasObject),
+		content: container.New(&columnLayout{separators: true}),
+		version: -1,
+	}
+	for _, column := range tableColumns {
+		label := NewColoredLabel(column.Title, ColorDarkGrey, 11, fyne.TextAlignCenter, true)
+		item.titles[column.Key] = label
+		item.boxes[column.Key] = label
+		if column.Compare != nil {
+			key := column.Key
+			item.boxes[key] = NewTappableBox(label, func() {
+				if item.OnSort != nil {
+					item.OnSort(key)
+				}
+			})
+		}
 	}
 
 	item.ExtendBaseWidget(item) // Critical for Fyne to recognize it as a widget
+	item.Update()
 	return item
 }
 
@@ -95,8 +205,40 @@ func NewPingHeaderWidget() *PingHeaderWidget {
 // CreateRenderer()
 // ****************************************************************************
 func (i *PingHeaderWidget) CreateRenderer() fyne.WidgetRenderer {
-	// We use a container to handle the layout of our internal components
-	content := container.NewGridWithRows(1, i.lblHostname, i.lblAddress, layout.NewSpacer(), i.lblLost, layout.NewSpacer(), i.lblPingValue, i.lblAverageValue, i.lblMinValue, i.lblMaxValue, i.lblRequests, i.lblDelete)
+	return widget.NewSimpleRenderer(i.content)
+}
+
+// ****************************************************************************
+// Update()
+// ****************************************************************************
+// Follows the visible columns and their widths
+func (i *PingHeaderWidget) Update() {
+	if i.version == columnsVersion {
+		return
+	}
+	var objects []fyne.CanvasObject
+	for idx, c := range shownColumns {
+		objects = append(objects, i.boxes[c.Key], newColumnSeparator(idx))
+	}
+	i.content.Objects = objects
+	i.content.Refresh()
+	i.version = columnsVersion
+}
 
-	return widget.NewSimpleRenderer(content)
+// ****************************************************************************
+// SetSort()
+// ****************************************************************************
+// Shows an arrow next to the title of the sorted column
+func (i *PingHeaderWidget) SetSort(column string, descending bool) {
+	for _, c := range tableColumns {
+		title := c.Title
+		if c.Key == column {
+			if descending {
+				title += " ↓"
+			} else {
+				title += " ↑"
+			}
+		}
+		i.titles[c.Key].SetText(title)
+	}
 }
@@ -0,0 +1,256 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// Route is the last hop list found by a traceroute to a target, "*" for the
+// hops which did not answer
+type Route struct {
+	Time time.Time `json:"time"`
+	Hops []string  `json:"hops"`
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var routeMutex sync.Mutex
+var routes = make(map[string]Route) // By address
+
+var routeTried = make(map[string]time.Time) // Last traceroute by address, failed ones included
+var routesFileMutex sync.Mutex              // Serializes the writes of routes.json
+
+// ****************************************************************************
+// routesFilePath()
+// ****************************************************************************
+func routesFilePath() (string, error) {
+	path, err := getAppFolderPath(AppFolderName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path, AppFolderMode); err != nil {
+		return "", err
+	}
+	return filepath.Join(path, RoutesFileName), nil
+}
+
+// ****************************************************************************
+// loadRoutes()
+// ****************************************************************************
+func loadRoutes() error {
+	path, err := routesFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // No route traced yet
+		}
+		return err
+	}
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+	return json.Unmarshal(data, &routes)
+}
+
+// ****************************************************************************
+// saveRoutes()
+// ****************************************************************************
+func saveRoutes() error {
+	path, err := routesFilePath()
+	if err != nil {
+		return err
+	}
+	// Held from the copy to the write, the last routes being written last
+	routesFileMutex.Lock()
+	defer routesFileMutex.Unlock()
+	routeMutex.Lock()
+	data, err := json.MarshalIndent(routes, "", "  ")
+	routeMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, AppFileMode)
+}
+
+// ****************************************************************************
+// routeInterval()
+// ****************************************************************************
+func routeInterval() time.Duration {
+	if minutes := currentSettings().RouteInterval; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return DefaultRouteInterval * time.Minute
+}
+
+// ****************************************************************************
+// defaultTraceProtocol()
+// ****************************************************************************
+// UDP is the only protocol traceroute sends without privileges, tracert
+// only sends ICMP
+func defaultTraceProtocol() string {
+	if runtime.GOOS == "windows" {
+		return "icmp"
+	}
+	return "udp"
+}
+
+// ****************************************************************************
+// startRouteTracing()
+// ****************************************************************************
+// Traces the route to the targets which asked for it, one at a time, each
+// every RouteInterval minutes
+func startRouteTracing(e *Engine) {
+	if err := loadRoutes(); err != nil {
+		slog.Warn("cannot load the routes", "error", err)
+	}
+	go func() {
+		for {
+			for _, m := range e.Monitors() {
+				if !m.Config.Trace || m.Config.Paused {
+					continue
+				}
+				routeMutex.Lock()
+				last := routes[m.Config.Address].Time
+				if tried := routeTried[m.Config.Address]; tried.After(last) {
+					last = tried
+				}
+				routeMutex.Unlock()
+				if time.Since(last) >= routeInterval() {
+					traceTarget(m)
+				}
+			}
+			time.Sleep(RouteCheckPeriod * time.Second)
+		}
+	}()
+}
+
+// ****************************************************************************
+// traceTarget()
+// ****************************************************************************
+// Traces the route to a target and publishes a RouteChange when it is not
+// the one found last time
+func traceTarget(m *Monitor) {
+	ctx, cancel := context.WithTimeout(context.Background(), TracerouteTimeout*time.Second)
+	defer cancel()
+	probes, err := traceroute(ctx, m.Config.Address, defaultTraceProtocol())
+	if err != nil {
+		// Tried again after routeInterval() too, not holding up the others
+		// at every RouteCheckPeriod
+		slog.Warn("route not traced", "address", m.Config.Address, "error", err)
+		routeMutex.Lock()
+		routeTried[m.Config.Address] = time.Now()
+		routeMutex.Unlock()
+		return
+	}
+	route := Route{Time: time.Now(), Hops: routeHops(probes)}
+
+	routeMutex.Lock()
+	old, known := routes[m.Config.Address]
+	if len(route.Hops) == 0 {
+		route.Hops = old.Hops // No router answered, the known route is kept
+	}
+	routes[m.Config.Address] = route
+	routeMutex.Unlock()
+	if err := saveRoutes(); err != nil {
+		slog.Warn("cannot save the routes", "error", err)
+	}
+	slog.Debug("route traced", "address", m.Config.Address, "hops", route.Hops)
+	if known && routeChanged(old.Hops, route.Hops) {
+		bus.Routes.Publish(RouteChange{Monitor: m, Old: old.Hops, New: route.Hops})
+	}
+}
+
+// ****************************************************************************
+// routeHops()
+// ****************************************************************************
+// Returns the router which answered at each TTL, "*" when none did, up to
+// the last one which answered
+func routeHops(probes []TraceProbe) []string {
+	var hops []string
+	for _, probe := range probes {
+		for len(hops) < probe.TTL {
+			hops = append(hops, "*")
+		}
+		if !probe.Lost {
+			hops[probe.TTL-1] = probe.Address
+		}
+	}
+	return trimSilentHops(hops)
+}
+
+// ****************************************************************************
+// trimSilentHops()
+// ****************************************************************************
+// Drops the "*" ending a route, up to the maximum TTL when the target does
+// not answer
+func trimSilentHops(hops []string) []string {
+	for len(hops) > 0 && hops[len(hops)-1] == "*" {
+		hops = hops[:len(hops)-1]
+	}
+	return hops
+}
+
+// ****************************************************************************
+// routeChanged()
+// ****************************************************************************
+// A route changed when it got longer or shorter, or when another router
+// answered at the same TTL. The silent hops are not taken into account,
+// routers often limiting their answers, nor a route where none answered.
+func routeChanged(before, after []string) bool {
+	before, after = trimSilentHops(before), trimSilentHops(after) // Routes saved by older versions
+	if len(before) == 0 || len(after) == 0 {
+		return false
+	}
+	if len(before) != len(after) {
+		return true
+	}
+	for idx := range before {
+		if before[idx] != "*" && after[idx] != "*" && before[idx] != after[idx] {
+			return true
+		}
+	}
+	return false
+}
+
+// ****************************************************************************
+// routeMessage()
+// ****************************************************************************
+// Describes a route change, with the hops which differ
+func routeMessage(c RouteChange) string {
+	name := c.Monitor.DisplayName()
+	if c.New == nil {
+		return fmt.Sprintf("%s route changed : TTL of the replies went from %d to %d", name, c.OldTTL, c.NewTTL)
+	}
+	var diff []string
+	for idx := range max(len(c.Old), len(c.New)) {
+		before, after := "-", "-"
+		if idx < len(c.Old) {
+			before = c.Old[idx]
+		}
+		if idx < len(c.New) {
+			after = c.New[idx]
+		}
+		if before != after && !slices.Contains([]string{before, after}, "*") {
+			diff = append(diff, fmt.Sprintf("hop %d %s -> %s", idx+1, before, after))
+		}
+	}
+	return fmt.Sprintf("%s route changed (%d hops, was %d) : %s", name, len(c.New), len(c.Old), strings.Join(diff, ", "))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TestRouteHops()
+// ****************************************************************************
+func TestRouteHops(t *testing.T) {
+	answer := func(ttl int, address string) TraceProbe { return TraceProbe{TTL: ttl, Address: address, RTT: 1} }
+	lost := func(ttl int) TraceProbe { return TraceProbe{TTL: ttl, Lost: true} }
+	for _, c := range []struct {
+		name   string
+		probes []TraceProbe
+		want   []string
+	}{
+		{"complete", []TraceProbe{answer(1, "192.168.1.1"), answer(2, "8.8.8.8")}, []string{"192.168.1.1", "8.8.8.8"}},
+		{"silent hop", []TraceProbe{answer(1, "192.168.1.1"), lost(2), answer(3, "8.8.8.8")}, []string{"192.168.1.1", "*", "8.8.8.8"}},
+		{"missing TTL", []TraceProbe{answer(1, "192.168.1.1"), answer(3, "8.8.8.8")}, []string{"192.168.1.1", "*", "8.8.8.8"}},
+		{"one probe lost", []TraceProbe{answer(1, "192.168.1.1"), lost(1)}, []string{"192.168.1.1"}},
+		{"silent target", []TraceProbe{answer(1, "192.168.1.1"), answer(2, "10.0.0.1"), lost(3), lost(4), lost(30)}, []string{"192.168.1.1", "10.0.0.1"}},
+		{"none answered", []TraceProbe{lost(1), lost(2)}, nil},
+	} {
+		if got := routeHops(c.probes); !slices.Equal(got, c.want) {
+			t.Errorf("%s : hops %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestRouteChanged()
+// ****************************************************************************
+func TestRouteChanged(t *testing.T) {
+	route := []string{"192.168.1.1", "10.0.0.1", "8.8.8.8"}
+	for _, c := range []struct {
+		name  string
+		after []string
+		want  bool
+	}{
+		{"same", []string{"192.168.1.1", "10.0.0.1", "8.8.8.8"}, false},
+		{"silent hop", []string{"192.168.1.1", "*", "8.8.8.8"}, false},
+		{"trailing silent hops", []string{"192.168.1.1", "10.0.0.1", "8.8.8.8", "*", "*"}, false},
+		{"none answered", []string{"*", "*", "*", "*"}, false},
+		{"other router", []string{"192.168.1.1", "10.0.0.2", "8.8.8.8"}, true},
+		{"longer", []string{"192.168.1.1", "10.0.0.1", "10.0.0.9", "8.8.8.8"}, true},
+		{"shorter", []string{"192.168.1.1", "8.8.8.8"}, true},
+	} {
+		if got := routeChanged(route, c.after); got != c.want {
+			t.Errorf("%s : changed %v, want %v", c.name, got, c.want)
+		}
+		if got := routeChanged(c.after, route); got != c.want {
+			t.Errorf("%s, reversed : changed %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestRouteMessage()
+// ****************************************************************************
+func TestRouteMessage(t *testing.T) {
+	m := NewEngine(time.Second).Add(TargetConfig{Address: "8.8.8.8", Name: "dns"})
+	for _, c := range []struct {
+		change RouteChange
+		want   string
+	}{
+		{RouteChange{Monitor: m, OldTTL: 58, NewTTL: 56},
+			"dns route changed : TTL of the replies went from 58 to 56"},
+		{RouteChange{Monitor: m, Old: []string{"192.168.1.1", "10.0.0.1", "8.8.8.8"}, New: []string{"192.168.1.1", "10.0.0.2", "8.8.8.8"}},
+			"dns route changed (3 hops, was 3) : hop 2 10.0.0.1 -> 10.0.0.2"},
+		{RouteChange{Monitor: m, Old: []string{"192.168.1.1", "*", "8.8.8.8"}, New: []string{"192.168.1.1", "10.0.0.2", "10.0.0.3", "8.8.8.8"}},
+			"dns route changed (4 hops, was 3) : hop 3 8.8.8.8 -> 10.0.0.3, hop 4 - -> 8.8.8.8"},
+	} {
+		if got := routeMessage(c.change); got != c.want {
+			t.Errorf("routeMessage()\n got %s\nwant %s", got, c.want)
+		}
+	}
+}
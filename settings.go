@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -19,54 +23,192 @@ type AppSettings struct {
 	WindowWidth     float32 `json:"window_width"`
 	WindowHeight    float32 `json:"window_height"`
 	SplitOffset     float64 `json:"split_offset"`
+	DetailOffset    float64 `json:"detail_offset"`
+	SortColumn      string  `json:"sort_column"` // Key of a tableColumns entry, empty for the engine order
+	SortDescending  bool    `json:"sort_descending"`
+	TargetFilter    string  `json:"target_filter"`
 	ThemePreference string  `json:"theme_preference"` // "Light" or "Dark"
 	PingDelimiter   string  `json:"ping_delimiter"`
+	PingInterval    int     `json:"ping_interval"` // Seconds
+	LogLevel        string  `json:"log_level"`     // "debug", "info" (default), "warn" or "error"
+	AnomalySigmas   float64 `json:"anomaly_sigmas"`
+	BaselinePerHour bool    `json:"baseline_per_hour"`
+	AnomalyAlerts   bool    `json:"anomaly_alerts"`
+	MetricsEnabled  bool    `json:"metrics_enabled"` // Prometheus endpoint
+	MetricsAddress  string  `json:"metrics_address"`
+	MetricsPort     int     `json:"metrics_port"`
+	APIEnabled      bool    `json:"api_enabled"` // REST API
+	APIAddress      string  `json:"api_address"`
+	APIPort         int     `json:"api_port"`
+	APIToken        string  `json:"api_token"`
+	WebEnabled      bool    `json:"web_enabled"` // Read-only web dashboard
+	WebAddress      string  `json:"web_address"`
+	WebPort         int     `json:"web_port"`
+	RouteInterval   int     `json:"route_interval"` // Minutes between two traceroutes of a target
+
+	Columns            []ColumnSetting     `json:"columns"` // Visible columns of the targets table, empty for the defaults
+	Targets            []TargetConfig      `json:"targets"`
+	Outputs            []SinkConfig        `json:"outputs"` // InfluxDB and Graphite
+	MQTT               MQTTConfig          `json:"mqtt"`
+	OTLP               OTLPConfig          `json:"otlp"` // OpenTelemetry metrics
+	Syslog             SyslogConfig        `json:"syslog"`
+	Silences           []Silence           `json:"silences"`
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows"`
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var configPath string           // Set by --config, defaults to ~/.pingo/config.json
+var appHome string              // Folder holding the app folder, the user's home when empty
+var targetsFromCommandLine bool // Such targets must not replace the configured ones
+var settingsMutex sync.Mutex    // Guards the settings and serializes the writes of their file
+var targetsMutex sync.Mutex     // Serializes saveTargets(), called by the UI and the API
+
+// ****************************************************************************
+// settingsFilePath()
+// ****************************************************************************
+func settingsFilePath() string {
+	if configPath != "" {
+		return configPath
+	}
+	path, _ := getAppFolderPath(AppFolderName)
+	return filepath.Join(path, SettingsFileName)
 }
 
 // ****************************************************************************
 // saveSettings()
 // ****************************************************************************
+// Writes the settings file, settingsMutex being held
 func saveSettings(settings AppSettings) error {
-	path, _ := getAppFolderPath(AppFolderName)
+	path := settingsFilePath()
 	// Create folder if missing
-	os.MkdirAll(filepath.Dir(path), 0755)
+	os.MkdirAll(filepath.Dir(path), AppFolderMode)
 	// Convert struct to JSON bytes
 	data, err := json.MarshalIndent(settings, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(path, SettingsFileName), data, 0644)
+	slog.Debug("settings saved", "path", path)
+	// The API token is in there
+	if err := os.WriteFile(path, data, AppFileMode); err != nil {
+		return err
+	}
+	return os.Chmod(path, AppFileMode) // Files written by older versions
+}
+
+// ****************************************************************************
+// updateSettings()
+// ****************************************************************************
+// Changes the settings then saves them. Once the goroutines are started,
+// every change goes through here and the goroutines other than the Fyne one
+// read the settings under settingsMutex.
+func updateSettings(change func(s *AppSettings)) error {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	change(&settings)
+	return saveSettings(settings)
+}
+
+// ****************************************************************************
+// currentSettings()
+// ****************************************************************************
+// Returns a copy of the settings, for the goroutines other than the Fyne one
+func currentSettings() AppSettings {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	return settings
+}
+
+// ****************************************************************************
+// saveTargets()
+// ****************************************************************************
+func saveTargets() error {
+	if targetsFromCommandLine {
+		return nil
+	}
+	targetsMutex.Lock()
+	defer targetsMutex.Unlock()
+	targets := engine.Targets()
+	return updateSettings(func(s *AppSettings) {
+		logTargetChanges(s.Targets, targets)
+		s.Targets = targets
+	})
 }
 
 // ****************************************************************************
 // loadSettings()
 // ****************************************************************************
 func loadSettings() (AppSettings, error) {
-	path, _ := getAppFolderPath(AppFolderName)
 	var settings AppSettings
-	data, err := os.ReadFile(filepath.Join(path, SettingsFileName))
+	data, err := os.ReadFile(settingsFilePath())
 	if err != nil {
 		return settings, err // Return empty config if file doesn't exist
 	}
 	err = json.Unmarshal(data, &settings)
+	parseMaintenanceWindows(settings.MaintenanceWindows)
 	return settings, err
 }
 
+// ****************************************************************************
+// metricsEndpoint()
+// ****************************************************************************
+func metricsEndpoint(settings AppSettings) (string, int) {
+	address, port := settings.MetricsAddress, settings.MetricsPort
+	if address == "" {
+		address = DefaultMetricsAddr
+	}
+	if port <= 0 {
+		port = DefaultMetricsPort
+	}
+	return address, port
+}
+
+// ****************************************************************************
+// apiEndpoint()
+// ****************************************************************************
+func apiEndpoint(settings AppSettings) (string, int) {
+	address, port := settings.APIAddress, settings.APIPort
+	if address == "" {
+		address = DefaultAPIAddr
+	}
+	if port <= 0 {
+		port = DefaultAPIPort
+	}
+	return address, port
+}
+
+// ****************************************************************************
+// webEndpoint()
+// ****************************************************************************
+func webEndpoint(settings AppSettings) (string, int) {
+	address, port := settings.WebAddress, settings.WebPort
+	if address == "" {
+		address = DefaultWebAddr
+	}
+	if port <= 0 {
+		port = DefaultWebPort
+	}
+	return address, port
+}
+
 // ****************************************************************************
 // getAppFolderPath()
 // ****************************************************************************
 func getAppFolderPath(folderName string) (string, error) {
 	// Get the user's home directory (e.g., /home/user or C:\Users\user)
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+	home := appHome
+	if home == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return "", err
+		}
 	}
 	// Define the full path
 	appPath := filepath.Join(home, folderName)
-	// Create the folder with 0755 permissions (rwxr-xr-x)
+	// Create the folder with 0700 permissions (rwx------)
 	// If it exists, MkdirAll returns nil (no error)
-	err = os.MkdirAll(appPath, 0755)
-	if err != nil {
+	if err := os.MkdirAll(appPath, AppFolderMode); err != nil {
 		return "", err
 	}
 	return appPath, nil
@@ -79,11 +221,21 @@ func showSettingsDialog(parentWin fyne.Window, myApp fyne.App, settings *AppSett
 	// 1. Existing Theme Selection
 	themeSelect := widget.NewSelect([]string{"Light", "Dark"}, func(value string) {
 		applyTheme(myApp, parentWin, value)
-		settings.ThemePreference = value
-		saveSettings(*settings)
+		updateSettings(func(s *AppSettings) { s.ThemePreference = value })
 	})
 	themeSelect.SetSelected(settings.ThemePreference)
 
+	// Log level, applied at once
+	logLevelSelect := widget.NewSelect([]string{"debug", "info", "warn", "error"}, func(value string) {
+		if value == settings.LogLevel {
+			return
+		}
+		updateSettings(func(s *AppSettings) { s.LogLevel = value })
+		logLevel.Set(parseLogLevel(value))
+		slog.Info("log level changed", "level", value)
+	})
+	logLevelSelect.SetSelected(strings.ToLower(parseLogLevel(settings.LogLevel).String()))
+
 	// 2. New Ping Delimiter Entry
 	pingEntry := widget.NewEntry()
 	pingEntry.SetText(settings.PingDelimiter)
@@ -91,24 +243,148 @@ func showSettingsDialog(parentWin fyne.Window, myApp fyne.App, settings *AppSett
 
 	// This function saves the setting as the user types
 	pingEntry.OnChanged = func(value string) {
-		settings.PingDelimiter = value
-		saveSettings(*settings)
+		updateSettings(func(s *AppSettings) { s.PingDelimiter = value })
+	}
+
+	// 3. Latency anomalies, against the baseline learned for each target
+	sigmasEntry := widget.NewEntry()
+	sigmasEntry.SetText(strconv.FormatFloat(anomalySigmas(), 'f', -1, 64))
+	sigmasEntry.OnChanged = func(value string) {
+		if sigmas, err := strconv.ParseFloat(value, 64); err == nil && sigmas > 0 {
+			updateSettings(func(s *AppSettings) { s.AnomalySigmas = sigmas })
+		}
+	}
+	perHourCheck := widget.NewCheck("Learn one baseline per hour of the week", func(checked bool) {
+		updateSettings(func(s *AppSettings) { s.BaselinePerHour = checked })
+	})
+	perHourCheck.SetChecked(settings.BaselinePerHour)
+	anomalyAlertsCheck := widget.NewCheck("Notify latency anomalies", func(checked bool) {
+		updateSettings(func(s *AppSettings) { s.AnomalyAlerts = checked })
+	})
+	anomalyAlertsCheck.SetChecked(settings.AnomalyAlerts)
+
+	// Route changes, for the targets asking for them
+	routeEntry := widget.NewEntry()
+	if settings.RouteInterval > 0 {
+		routeEntry.SetText(strconv.Itoa(settings.RouteInterval))
+	}
+	routeEntry.PlaceHolder = strconv.Itoa(DefaultRouteInterval)
+	routeEntry.OnChanged = func(value string) {
+		if minutes, err := strconv.Atoi(value); err == nil && minutes > 0 {
+			updateSettings(func(s *AppSettings) { s.RouteInterval = minutes })
+		}
+	}
+
+	// 4. Prometheus endpoint, taken into account at the next start
+	metricsCheck := widget.NewCheck("Serve Prometheus metrics (restart required)", func(checked bool) {
+		updateSettings(func(s *AppSettings) { s.MetricsEnabled = checked })
+	})
+	metricsCheck.SetChecked(settings.MetricsEnabled)
+	metricsAddrEntry := widget.NewEntry()
+	metricsAddrEntry.SetText(settings.MetricsAddress)
+	metricsAddrEntry.PlaceHolder = DefaultMetricsAddr
+	metricsAddrEntry.OnChanged = func(value string) {
+		updateSettings(func(s *AppSettings) { s.MetricsAddress = value })
+	}
+	metricsPortEntry := widget.NewEntry()
+	if settings.MetricsPort > 0 {
+		metricsPortEntry.SetText(strconv.Itoa(settings.MetricsPort))
+	}
+	metricsPortEntry.PlaceHolder = strconv.Itoa(DefaultMetricsPort)
+	metricsPortEntry.OnChanged = func(value string) {
+		if port, err := strconv.Atoi(value); err == nil {
+			updateSettings(func(s *AppSettings) { s.MetricsPort = port })
+		}
+	}
+
+	// 5. REST API, taken into account at the next start
+	apiCheck := widget.NewCheck("Serve the REST API (restart required)", func(checked bool) {
+		updateSettings(func(s *AppSettings) {
+			s.APIEnabled = checked
+			if checked && s.APIToken == "" {
+				s.APIToken = newAPIToken()
+			}
+		})
+	})
+	apiCheck.SetChecked(settings.APIEnabled)
+	apiAddrEntry := widget.NewEntry()
+	apiAddrEntry.SetText(settings.APIAddress)
+	apiAddrEntry.PlaceHolder = DefaultAPIAddr
+	apiAddrEntry.OnChanged = func(value string) {
+		updateSettings(func(s *AppSettings) { s.APIAddress = value })
+	}
+	apiPortEntry := widget.NewEntry()
+	if settings.APIPort > 0 {
+		apiPortEntry.SetText(strconv.Itoa(settings.APIPort))
+	}
+	apiPortEntry.PlaceHolder = strconv.Itoa(DefaultAPIPort)
+	apiPortEntry.OnChanged = func(value string) {
+		if port, err := strconv.Atoi(value); err == nil {
+			updateSettings(func(s *AppSettings) { s.APIPort = port })
+		}
+	}
+	apiTokenEntry := widget.NewEntry()
+	apiTokenEntry.SetText(settings.APIToken)
+	apiTokenEntry.OnChanged = func(value string) {
+		updateSettings(func(s *AppSettings) { s.APIToken = value })
+	}
+
+	// 6. Web dashboard, taken into account at the next start
+	webCheck := widget.NewCheck("Serve the web dashboard (restart required)", func(checked bool) {
+		updateSettings(func(s *AppSettings) { s.WebEnabled = checked })
+	})
+	webCheck.SetChecked(settings.WebEnabled)
+	webAddrEntry := widget.NewEntry()
+	webAddrEntry.SetText(settings.WebAddress)
+	webAddrEntry.PlaceHolder = DefaultWebAddr
+	webAddrEntry.OnChanged = func(value string) {
+		updateSettings(func(s *AppSettings) { s.WebAddress = value })
+	}
+	webPortEntry := widget.NewEntry()
+	if settings.WebPort > 0 {
+		webPortEntry.SetText(strconv.Itoa(settings.WebPort))
+	}
+	webPortEntry.PlaceHolder = strconv.Itoa(DefaultWebPort)
+	webPortEntry.OnChanged = func(value string) {
+		if port, err := strconv.Atoi(value); err == nil {
+			updateSettings(func(s *AppSettings) { s.WebPort = port })
+		}
 	}
 
-	// 3. Assemble the Content
+	// 7. Assemble the Content
 	content := container.NewVBox(
 		widget.NewLabel("Preferred Theme:"),
 		themeSelect,
+		widget.NewLabel("Log Level:"),
+		logLevelSelect,
 		widget.NewSeparator(), // Adds a nice line between sections
 		widget.NewLabel("Ping 'Time' Delimiter (OS Specific):"),
 		pingEntry,
 		widget.NewLabelWithStyle("(English: 'time=', French: 'temps=')",
 			fyne.TextAlignLeading, fyne.TextStyle{Italic: true}),
+		widget.NewSeparator(),
+		widget.NewLabel("Anomaly Threshold (sigmas):"),
+		sigmasEntry,
+		perHourCheck,
+		anomalyAlertsCheck,
+		widget.NewLabel("Route Check Interval (minutes):"),
+		routeEntry,
+		widget.NewSeparator(),
+		metricsCheck,
+		container.NewGridWithColumns(2, metricsAddrEntry, metricsPortEntry),
+		widget.NewSeparator(),
+		apiCheck,
+		container.NewGridWithColumns(2, apiAddrEntry, apiPortEntry),
+		widget.NewLabel("API Token:"),
+		apiTokenEntry,
+		widget.NewSeparator(),
+		webCheck,
+		container.NewGridWithColumns(2, webAddrEntry, webPortEntry),
 	)
 
 	d := dialog.NewCustom("Settings", "Close", content, parentWin)
 	// We increase the height slightly to fit the new fields
-	d.Resize(fyne.NewSize(350, 250))
+	d.Resize(fyne.NewSize(400, 840))
 	d.Show()
 }
 
@@ -0,0 +1,221 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// Silence mutes the alerts of one target (or all of them when Target is
+// empty) until a given time
+type Silence struct {
+	Target string    `json:"target"`
+	Until  time.Time `json:"until"`
+}
+
+// MaintenanceWindow mutes alerts for Duration minutes every time its cron
+// schedule fires, e.g. "0 2 * * 0" for two hours each Sunday at 2:00
+type MaintenanceWindow struct {
+	Target   string `json:"target"`
+	Schedule string `json:"schedule"`
+	Duration int    `json:"duration"` // Minutes
+	Comment  string `json:"comment"`
+
+	cron *CronSchedule // Parsed Schedule, nil when it is invalid
+}
+
+// ****************************************************************************
+// silenceTarget()
+// ****************************************************************************
+func silenceTarget(address string, d time.Duration) {
+	updateSettings(func(s *AppSettings) {
+		s.Silences = append(pruneSilences(s.Silences, address), Silence{
+			Target: address,
+			Until:  time.Now().Add(d),
+		})
+	})
+	slog.Info("target silenced", "address", address, "until", time.Now().Add(d))
+}
+
+// ****************************************************************************
+// unsilenceTarget()
+// ****************************************************************************
+func unsilenceTarget(address string) {
+	updateSettings(func(s *AppSettings) { s.Silences = pruneSilences(s.Silences, address) })
+	slog.Info("target unsilenced", "address", address)
+}
+
+// ****************************************************************************
+// pruneSilences()
+// ****************************************************************************
+// Drops the expired silences and the ones matching address
+func pruneSilences(silences []Silence, address string) []Silence {
+	var kept []Silence
+	now := time.Now()
+	for _, s := range silences {
+		if s.Target != address && now.Before(s.Until) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// ****************************************************************************
+// silencedUntil()
+// ****************************************************************************
+// Returns the end of the ad hoc silence set on address, if any
+func silencedUntil(address string) (time.Time, bool) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	now := time.Now()
+	for _, s := range settings.Silences {
+		if s.Target == address && now.Before(s.Until) {
+			return s.Until, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ****************************************************************************
+// isSilenced()
+// ****************************************************************************
+func isSilenced(address string, t time.Time) bool {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	for _, s := range settings.Silences {
+		if (s.Target == "" || s.Target == address) && t.Before(s.Until) {
+			return true
+		}
+	}
+	for _, mw := range settings.MaintenanceWindows {
+		if (mw.Target == "" || mw.Target == address) && mw.ActiveAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ****************************************************************************
+// NewMaintenanceWindow()
+// ****************************************************************************
+func NewMaintenanceWindow(target, schedule string, duration int, comment string) (MaintenanceWindow, error) {
+	mw := MaintenanceWindow{Target: target, Schedule: schedule, Duration: duration, Comment: comment}
+	var err error
+	mw.cron, err = ParseCron(schedule)
+	return mw, err
+}
+
+// ****************************************************************************
+// parseMaintenanceWindows()
+// ****************************************************************************
+// Parses the schedules of the windows read from the settings once and for all
+func parseMaintenanceWindows(windows []MaintenanceWindow) {
+	for idx := range windows {
+		var err error
+		if windows[idx].cron, err = ParseCron(windows[idx].Schedule); err != nil {
+			slog.Warn("maintenance window ignored", "schedule", windows[idx].Schedule, "error", err)
+		}
+	}
+}
+
+// ****************************************************************************
+// ActiveAt()
+// ****************************************************************************
+// A window is active when its schedule fired less than Duration minutes ago
+func (mw MaintenanceWindow) ActiveAt(t time.Time) bool {
+	if mw.cron == nil || mw.Duration <= 0 {
+		return false
+	}
+	since := t.Truncate(time.Minute).Add(-time.Duration(mw.Duration-1) * time.Minute)
+	_, ok := mw.cron.Previous(t, since)
+	return ok
+}
+
+// ****************************************************************************
+// showMaintenanceDialog()
+// ****************************************************************************
+func showMaintenanceDialog(parentWin fyne.Window) {
+	list := container.NewVBox()
+	var refreshList func()
+	refreshList = func() {
+		list.RemoveAll()
+		windows := append([]MaintenanceWindow(nil), settings.MaintenanceWindows...)
+		if len(windows) == 0 {
+			list.Add(widget.NewLabel("No maintenance window"))
+		}
+		for idx, mw := range windows {
+			target := mw.Target
+			if target == "" {
+				target = "all targets"
+			}
+			text := fmt.Sprintf("%s  %s  (%d min)  %s", target, mw.Schedule, mw.Duration, mw.Comment)
+			list.Add(container.NewBorder(nil, nil, nil, NewSlimButton("Delete", func() {
+				updateSettings(func(s *AppSettings) {
+					s.MaintenanceWindows = slices.Delete(s.MaintenanceWindows, idx, idx+1)
+				})
+				slog.Info("maintenance window removed", "target", mw.Target, "schedule", mw.Schedule)
+				refreshList()
+			}), widget.NewLabel(text)))
+		}
+	}
+	refreshList()
+
+	targetEntry := widget.NewEntry()
+	targetEntry.PlaceHolder = "Address (empty for all targets)"
+	scheduleEntry := widget.NewEntry()
+	scheduleEntry.PlaceHolder = "Cron schedule, e.g. 0 2 * * 0"
+	durationEntry := widget.NewEntry()
+	durationEntry.PlaceHolder = "Duration in minutes"
+	commentEntry := widget.NewEntry()
+	commentEntry.PlaceHolder = "Comment"
+
+	addButton := widget.NewButton("Add", func() {
+		duration, err := strconv.Atoi(durationEntry.Text)
+		if err != nil || duration <= 0 {
+			dialog.ShowError(fmt.Errorf("invalid duration %q", durationEntry.Text), parentWin)
+			return
+		}
+		mw, err := NewMaintenanceWindow(targetEntry.Text, scheduleEntry.Text, duration, commentEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, parentWin)
+			return
+		}
+		updateSettings(func(s *AppSettings) { s.MaintenanceWindows = append(s.MaintenanceWindows, mw) })
+		slog.Info("maintenance window added", "target", targetEntry.Text, "schedule", scheduleEntry.Text, "duration", duration)
+		scheduleEntry.SetText("")
+		durationEntry.SetText("")
+		commentEntry.SetText("")
+		refreshList()
+	})
+
+	content := container.NewBorder(
+		nil,
+		container.NewVBox(
+			widget.NewSeparator(),
+			targetEntry,
+			scheduleEntry,
+			durationEntry,
+			commentEntry,
+			addButton,
+		),
+		nil, nil,
+		container.NewVScroll(list),
+	)
+
+	d := dialog.NewCustom("Maintenance Windows", "Close", content, parentWin)
+	d.Resize(fyne.NewSize(500, 400))
+	d.Show()
+}
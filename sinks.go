@@ -0,0 +1,296 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// SinkConfig describes an output every sample is written to
+type SinkConfig struct {
+	Type  string `json:"type"`            // "influx" or "graphite"
+	URL   string `json:"url"`             // http(s)://host:8086/api/v2/write?org=o&bucket=b, udp://host:8089 or tcp://host:2003
+	Token string `json:"token,omitempty"` // InfluxDB API token
+	// Metric names per target group, "" being the default. Influx templates
+	// give the measurement, Graphite ones the path prefix. {name}, {address},
+	// {group} and {probe} are replaced by the target values.
+	Templates     map[string]string `json:"templates,omitempty"`
+	BatchSize     int               `json:"batch_size,omitempty"`     // Lines per write
+	FlushInterval int               `json:"flush_interval,omitempty"` // Seconds
+	BufferSize    int               `json:"buffer_size,omitempty"`    // Lines kept while the server is unreachable
+}
+
+// Sink batches the encoded samples and writes them, keeping them while the
+// server is unreachable. When the buffer is full the oldest lines are lost.
+type Sink struct {
+	config  SinkConfig
+	host    string
+	encode  func(m *Monitor, s Sample) []string
+	write   func(lines []string) error
+	mu      sync.Mutex
+	pending []string
+	dropped int
+	failing bool
+	flush   chan struct{}
+	stop    chan struct{} // Closed by stopSinks()
+	done    chan struct{} // Closed when run() returns
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var templateField = regexp.MustCompile(`\{(name|address|group|probe)\}`)
+var sinks []*Sink
+
+// ****************************************************************************
+// startSinks()
+// ****************************************************************************
+// Creates the configured sinks and feeds them with the samples of the bus
+func startSinks(configs []SinkConfig) error {
+	var started []*Sink
+	for idx, cfg := range configs {
+		sink, err := newSink(cfg)
+		if err != nil {
+			return fmt.Errorf("output #%d : %w", idx+1, err)
+		}
+		started = append(started, sink)
+	}
+	if len(started) == 0 {
+		return nil
+	}
+	sinks = started
+	for _, sink := range sinks {
+		go sink.run()
+	}
+
+	On(bus.Subscribe("outputs"), &bus.Samples, func(r ProbeResult) {
+		for _, sink := range sinks {
+			sink.Add(r.Monitor, r.Sample)
+		}
+	})
+	return nil
+}
+
+// ****************************************************************************
+// stopSinks()
+// ****************************************************************************
+// Writes the pending lines of every sink, giving up on the ones still
+// unwritten after SinkStopTimeout
+func stopSinks() {
+	for _, sink := range sinks {
+		close(sink.stop)
+	}
+	deadline := time.After(SinkStopTimeout * time.Second)
+	for _, sink := range sinks {
+		select {
+		case <-sink.done:
+		case <-deadline:
+			slog.Warn("outputs not flushed in time, lines lost", "output", sink.String())
+			return
+		}
+	}
+}
+
+// ****************************************************************************
+// newSink()
+// ****************************************************************************
+func newSink(cfg SinkConfig) (*Sink, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultSinkBatch
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultSinkFlush
+	}
+	if cfg.BufferSize < cfg.BatchSize {
+		cfg.BufferSize = max(DefaultSinkBuffer, cfg.BatchSize)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &Sink{config: cfg, host: u.Host, flush: make(chan struct{}, 1),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	switch cfg.Type {
+	case "influx":
+		sink.encode = func(m *Monitor, s Sample) []string {
+			return []string{influxLine(expandTemplate(cfg.Templates, m, DefaultInfluxTemplate, escapeInfluxName), m, s)}
+		}
+		switch u.Scheme {
+		case "http", "https":
+			sink.write = influxHTTPWriter(cfg.URL, cfg.Token)
+		case "udp":
+			sink.write = influxUDPWriter(u.Host)
+		default:
+			return nil, fmt.Errorf("influx outputs need a http, https or udp URL")
+		}
+	case "graphite":
+		if u.Scheme != "tcp" {
+			return nil, fmt.Errorf("graphite outputs need a tcp URL")
+		}
+		sink.encode = func(m *Monitor, s Sample) []string {
+			return graphiteLines(expandTemplate(cfg.Templates, m, DefaultGraphiteTemplate, graphiteNode), s)
+		}
+		sink.write = graphiteWriter(u.Host)
+	default:
+		return nil, fmt.Errorf("unknown output type %q, expected influx or graphite", cfg.Type)
+	}
+	return sink, nil
+}
+
+// ****************************************************************************
+// expandTemplate()
+// ****************************************************************************
+// Returns the metric name of a target, the values being escaped for the
+// output format
+func expandTemplate(templates map[string]string, m *Monitor, fallback string, escape func(string) string) string {
+	template, ok := templates[m.Config.Group]
+	if !ok {
+		if template, ok = templates[""]; !ok {
+			template = fallback
+		}
+	}
+	return expandFields(template, m, escape)
+}
+
+// ****************************************************************************
+// expandFields()
+// ****************************************************************************
+// Replaces {name}, {address}, {group} and {probe} by the target values
+func expandFields(template string, m *Monitor, escape func(string) string) string {
+	return templateField.ReplaceAllStringFunc(template, func(field string) string {
+		switch field {
+		case "{name}":
+			return escape(m.DisplayName())
+		case "{address}":
+			return escape(m.Config.Address)
+		case "{group}":
+			return escape(m.Config.Group)
+		}
+		return escape(ProbeTypeICMP)
+	})
+}
+
+// ****************************************************************************
+// String()
+// ****************************************************************************
+// Names the sink in the logs, without the credentials the URL may hold
+func (k *Sink) String() string {
+	return k.config.Type + " " + k.host
+}
+
+// ****************************************************************************
+// Add()
+// ****************************************************************************
+func (k *Sink) Add(m *Monitor, s Sample) {
+	lines := k.encode(m, s)
+	k.mu.Lock()
+	k.pending = append(k.pending, lines...)
+	if over := len(k.pending) - k.config.BufferSize; over > 0 {
+		k.pending = k.pending[over:]
+		k.dropped += over
+	}
+	full := len(k.pending) >= k.config.BatchSize && !k.failing
+	k.mu.Unlock()
+
+	if full {
+		select {
+		case k.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ****************************************************************************
+// run()
+// ****************************************************************************
+// Writes the pending lines every flush interval, or as soon as a batch is
+// full. Failed batches stay pending and are retried at the next interval.
+// Once stopped, the lines left are written a last time.
+func (k *Sink) run() {
+	defer close(k.done)
+	ticker := time.NewTicker(time.Duration(k.config.FlushInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-k.flush:
+		case <-k.stop:
+			k.flushPending()
+			return
+		}
+		k.flushPending()
+	}
+}
+
+// ****************************************************************************
+// flushPending()
+// ****************************************************************************
+func (k *Sink) flushPending() {
+	for {
+		k.mu.Lock()
+		n := min(len(k.pending), k.config.BatchSize)
+		batch := k.pending[:n:n]
+		k.pending = k.pending[n:]
+		k.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+
+		err := k.write(batch)
+		k.mu.Lock()
+		wasFailing, lost := k.failing, 0
+		k.failing = err != nil
+		if err != nil {
+			// Back in front of the lines added meanwhile, the oldest ones
+			// being lost when the buffer overflows
+			k.pending = append(batch, k.pending...)
+			if over := len(k.pending) - k.config.BufferSize; over > 0 {
+				k.pending = k.pending[over:]
+				k.dropped += over
+			}
+		} else {
+			lost, k.dropped = k.dropped, 0
+		}
+		k.mu.Unlock()
+
+		if err != nil {
+			if !wasFailing {
+				slog.Warn("output failing, retrying", "output", k.String(), "error", err)
+			}
+			return
+		}
+		if wasFailing {
+			slog.Info("output recovered", "output", k.String())
+		}
+		if lost > 0 {
+			slog.Warn("output buffer full, lines lost", "output", k.String(), "lost", lost)
+		}
+	}
+}
+
+// ****************************************************************************
+// graphiteNode()
+// ****************************************************************************
+// Makes a value usable as one node of a Graphite path
+func graphiteNode(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, value)
+}
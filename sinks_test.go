@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TestInfluxLine()
+// ****************************************************************************
+func TestInfluxLine(t *testing.T) {
+	for _, c := range []struct{ value, want string }{
+		{"pingo", "pingo"},
+		{"my pings,lan", `my\ pings\,lan`},
+		{"a=b", "a=b"},
+	} {
+		if got := escapeInfluxName(c.value); got != c.want {
+			t.Errorf("escapeInfluxName(%q) = %q, want %q", c.value, got, c.want)
+		}
+	}
+
+	e := NewEngine(time.Second)
+	at := time.Unix(1700000000, 5)
+	for _, c := range []struct {
+		target TargetConfig
+		sample Sample
+		want   string
+	}{
+		{TargetConfig{Address: "8.8.8.8", Name: "dns"}, Sample{Time: at, RTT: 12.3},
+			"pingo,address=8.8.8.8,name=dns,probe=icmp rtt=12.3,lost=false 1700000000000000005"},
+		{TargetConfig{Address: "192.0.2.1", Group: "lan"}, Sample{Time: at, Lost: true},
+			"pingo,address=192.0.2.1,group=lan,name=192.0.2.1,probe=icmp lost=true 1700000000000000005"},
+		{TargetConfig{Address: "192.0.2.2", Name: "my box,a=b"}, Sample{Time: at, RTT: 0.25},
+			`pingo,address=192.0.2.2,name=my\ box\,a\=b,probe=icmp rtt=0.25,lost=false 1700000000000000005`},
+	} {
+		if got := influxLine("pingo", e.Add(c.target), c.sample); got != c.want {
+			t.Errorf("influxLine(%+v)\n got %s\nwant %s", c.target, got, c.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestGraphiteLines()
+// ****************************************************************************
+func TestGraphiteLines(t *testing.T) {
+	for _, c := range []struct{ value, want string }{
+		{"", "none"},
+		{"router-1_a", "router-1_a"},
+		{"192.168.1.1", "192_168_1_1"},
+		{"my box/é", "my_box__"},
+	} {
+		if got := graphiteNode(c.value); got != c.want {
+			t.Errorf("graphiteNode(%q) = %q, want %q", c.value, got, c.want)
+		}
+	}
+
+	at := time.Unix(1700000000, 0)
+	if got, want := graphiteLines("pingo.lan.dns", Sample{Time: at, RTT: 12.5}),
+		[]string{"pingo.lan.dns.rtt 12.5 1700000000", "pingo.lan.dns.lost 0 1700000000"}; !slices.Equal(got, want) {
+		t.Errorf("lines %q, want %q", got, want)
+	}
+	if got, want := graphiteLines("pingo.lan.dns", Sample{Time: at, Lost: true}),
+		[]string{"pingo.lan.dns.lost 1 1700000000"}; !slices.Equal(got, want) {
+		t.Errorf("lost lines %q, want %q", got, want)
+	}
+}
+
+// ****************************************************************************
+// TestExpandTemplate()
+// ****************************************************************************
+// The group template wins over the default one, which wins over the fallback
+func TestExpandTemplate(t *testing.T) {
+	e := NewEngine(time.Second)
+	lan := e.Add(TargetConfig{Address: "192.168.1.1", Name: "my router", Group: "lan"})
+	wan := e.Add(TargetConfig{Address: "8.8.8.8", Group: "wan"})
+	templates := map[string]string{
+		"lan": "home.{group}.{name}.{probe}",
+		"":    "net.{address}",
+	}
+	for _, c := range []struct {
+		templates map[string]string
+		m         *Monitor
+		want      string
+	}{
+		{templates, lan, "home.lan.my_router.icmp"},
+		{templates, wan, "net.8_8_8_8"},
+		{nil, lan, "pingo.lan.my_router"},
+		{map[string]string{"": "{unknown}.{group}"}, wan, "{unknown}.wan"},
+	} {
+		if got := expandTemplate(c.templates, c.m, DefaultGraphiteTemplate, graphiteNode); got != c.want {
+			t.Errorf("expandTemplate(%v, %s) = %q, want %q", c.templates, c.m.Config.Address, got, c.want)
+		}
+	}
+	if got := expandFields("{name} {group}", lan, escapeInfluxName); got != `my\ router lan` {
+		t.Errorf("expandFields() = %q", got)
+	}
+}
+
+// ****************************************************************************
+// newTestInflux()
+// ****************************************************************************
+// Serves an InfluxDB write API answering 503 while down is set, and returns
+// the bodies of the writes it accepted
+func newTestInflux(t *testing.T) (*httptest.Server, *atomic.Bool, func() []string) {
+	var mu sync.Mutex
+	var writes []string
+	down := new(atomic.Bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("authorization %q", r.Header.Get("Authorization"))
+		}
+		if down.Load() {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		writes = append(writes, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, down, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(writes)
+	}
+}
+
+// ****************************************************************************
+// TestSinkRetry()
+// ****************************************************************************
+// Lines are written in batches, kept while the server fails, the oldest
+// being lost once the buffer is full, and written after the recovery
+func TestSinkRetry(t *testing.T) {
+	server, down, writes := newTestInflux(t)
+	sink, err := newSink(SinkConfig{Type: "influx", URL: server.URL + "/api/v2/write", Token: "secret",
+		Templates: map[string]string{"": "{name}"}, BatchSize: 2, BufferSize: 3, FlushInterval: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(time.Second)
+	add := func(name string) {
+		sink.Add(e.Add(TargetConfig{Address: "192.0.2.1", Name: name}), Sample{Time: time.Unix(1, 0), RTT: 1})
+	}
+	line := func(name string) string {
+		return name + ",address=192.0.2.1,name=" + name + ",probe=icmp rtt=1,lost=false 1000000000"
+	}
+	body := func(names ...string) string {
+		var lines strings.Builder
+		for _, name := range names {
+			lines.WriteString(line(name) + "\n")
+		}
+		return lines.String()
+	}
+
+	add("a")
+	add("b")
+	if len(sink.flush) != 1 {
+		t.Error("full batch not signaled")
+	}
+	<-sink.flush
+	sink.flushPending()
+	if got := writes(); !slices.Equal(got, []string{body("a", "b")}) {
+		t.Fatalf("writes %q", got)
+	}
+
+	down.Store(true)
+	add("c")
+	add("d")
+	<-sink.flush
+	sink.flushPending()
+	add("e")
+	add("f")
+	if len(sink.flush) != 0 {
+		t.Error("full batch signaled while the output fails")
+	}
+	sink.flushPending()
+	if !sink.failing || sink.dropped != 1 || !slices.Equal(sink.pending, []string{line("d"), line("e"), line("f")}) {
+		t.Fatalf("failing %v, dropped %d, pending %q", sink.failing, sink.dropped, sink.pending)
+	}
+
+	down.Store(false)
+	sink.flushPending()
+	if got := writes()[1:]; !slices.Equal(got, []string{body("d", "e"), body("f")}) {
+		t.Errorf("writes after the recovery %q", got)
+	}
+	if sink.failing || sink.dropped != 0 || len(sink.pending) != 0 {
+		t.Errorf("failing %v, dropped %d, pending %q", sink.failing, sink.dropped, sink.pending)
+	}
+}
+
+// ****************************************************************************
+// TestStopSinks()
+// ****************************************************************************
+// Stopping writes the lines still waiting for the flush interval
+func TestStopSinks(t *testing.T) {
+	server, _, writes := newTestInflux(t)
+	sink, err := newSink(SinkConfig{Type: "influx", URL: server.URL, Token: "secret", FlushInterval: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinks = []*Sink{sink}
+	t.Cleanup(func() { sinks = nil })
+	go sink.run()
+
+	sink.Add(NewEngine(time.Second).Add(TargetConfig{Address: "192.0.2.1"}), Sample{Time: time.Unix(1, 0), Lost: true})
+	stopSinks()
+	select {
+	case <-sink.done:
+	default:
+		t.Fatal("run() still running")
+	}
+	if got := writes(); len(got) != 1 || !strings.HasSuffix(got[0], " lost=true 1000000000\n") {
+		t.Errorf("writes %q", got)
+	}
+}
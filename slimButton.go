@@ -17,9 +17,10 @@ import (
 // ****************************************************************************
 type SlimButton struct {
 	widget.BaseWidget
-	Text     string
-	OnTapped func()
-	hovering bool // Tracks the hover state
+	Text              string
+	OnTapped          func()
+	OnTappedSecondary func(ev *fyne.PointEvent) // Right click, nil to ignore it
+	hovering          bool                      // Tracks the hover state
 }
 
 type slimButtonRenderer struct {
@@ -100,7 +101,11 @@ func (i *SlimButton) Tapped(_ *fyne.PointEvent) {
 // ****************************************************************************
 // TappedSecondary()
 // ****************************************************************************
-func (i *SlimButton) TappedSecondary(_ *fyne.PointEvent) {} // Required for interface
+func (i *SlimButton) TappedSecondary(ev *fyne.PointEvent) {
+	if i.OnTappedSecondary != nil {
+		i.OnTappedSecondary(ev)
+	}
+}
 
 // ****************************************************************************
 // MouseIn()
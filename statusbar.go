@@ -0,0 +1,325 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// TappableBox makes any content react to a click
+type TappableBox struct {
+	widget.BaseWidget
+	content  fyne.CanvasObject
+	OnTapped func()
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var statusLabel = widget.NewLabel(StatusDefaultMessage)
+var statusLight *canvas.Circle
+var healthLight *canvas.Circle
+var healthLabel = widget.NewLabel("")
+var statusMutex sync.Mutex
+var lastMessageTime time.Time
+var statusHistory []StatusMessage // Oldest first
+var historyChanged func()         // Set while the history panel is open
+
+// ****************************************************************************
+// String()
+// ****************************************************************************
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// ****************************************************************************
+// Color()
+// ****************************************************************************
+func (s Severity) Color() color.Color {
+	switch s {
+	case SeverityWarning:
+		return ColorYellow
+	case SeverityError:
+		return ColorRed
+	default:
+		return ColorLightBlue
+	}
+}
+
+// ****************************************************************************
+// NewTappableBox()
+// ****************************************************************************
+func NewTappableBox(content fyne.CanvasObject, tapped func()) *TappableBox {
+	b := &TappableBox{content: content, OnTapped: tapped}
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+// ****************************************************************************
+// CreateRenderer()
+// ****************************************************************************
+func (b *TappableBox) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(b.content)
+}
+
+// ****************************************************************************
+// Tapped()
+// ****************************************************************************
+func (b *TappableBox) Tapped(_ *fyne.PointEvent) {
+	if b.OnTapped != nil {
+		b.OnTapped()
+	}
+}
+
+// ****************************************************************************
+// Cursor()
+// ****************************************************************************
+func (b *TappableBox) Cursor() desktop.Cursor {
+	return desktop.PointerCursor
+}
+
+// ****************************************************************************
+// createStatusBar()
+// ****************************************************************************
+// The light on the left shows the severity of the current message, the one
+// on the right the health of the targets. Clicking the message opens the
+// history.
+func createStatusBar() fyne.CanvasObject {
+	statusLight = newLight(ColorGreen)
+	healthLight = newLight(ColorLightGrey)
+
+	versionLabel := widget.NewLabel(Version)
+	versionLabel.TextStyle = fyne.TextStyle{Italic: true} // Make it look distinct
+
+	message := NewTappableBox(container.NewHBox(container.NewCenter(lightSlot(statusLight)), statusLabel), func() {
+		showStatusHistory(w)
+	})
+	barContent := container.NewHBox(
+		message,
+		layout.NewSpacer(), // PUSHES everything apart
+		container.NewCenter(lightSlot(healthLight)),
+		healthLabel,
+		versionLabel, // Stays on the RIGHT
+	)
+
+	line := canvas.NewRectangle(ColorLightGrey)
+	line.SetMinSize(fyne.NewSize(0, 1))
+
+	return container.NewVBox(
+		line,
+		barContent,
+	)
+}
+
+// ****************************************************************************
+// newLight()
+// ****************************************************************************
+func newLight(fill color.Color) *canvas.Circle {
+	light := canvas.NewCircle(fill)
+	light.StrokeColor = ColorBlack
+	light.StrokeWidth = 1
+	return light
+}
+
+// ****************************************************************************
+// lightSlot()
+// ****************************************************************************
+func lightSlot(light *canvas.Circle) fyne.CanvasObject {
+	rect := canvas.NewRectangle(color.Transparent)
+	rect.SetMinSize(fyne.NewSize(16, 16)) // This forces the "slot" to be 16x16
+	return container.NewStack(rect, light)
+}
+
+// ****************************************************************************
+// showStatus()
+// ****************************************************************************
+// Publishes a message for the status bar, from any goroutine and in any mode
+func showStatus(message string) {
+	publishStatus(SeverityInfo, message)
+}
+
+// ****************************************************************************
+// showWarning()
+// ****************************************************************************
+func showWarning(message string) {
+	publishStatus(SeverityWarning, message)
+}
+
+// ****************************************************************************
+// showError()
+// ****************************************************************************
+func showError(message string) {
+	publishStatus(SeverityError, message)
+}
+
+// ****************************************************************************
+// publishStatus()
+// ****************************************************************************
+func publishStatus(severity Severity, message string) {
+	bus.Status.Publish(StatusMessage{Time: time.Now(), Severity: severity, Text: message})
+}
+
+// ****************************************************************************
+// renderStatus()
+// ****************************************************************************
+// Shows the message until a newer one or StatusTimeout, and keeps it in the
+// history
+func renderStatus(msg StatusMessage) {
+	statusMutex.Lock()
+	lastMessageTime = msg.Time
+	statusHistory = append(statusHistory, msg)
+	if len(statusHistory) > StatusHistoryKept {
+		statusHistory = statusHistory[len(statusHistory)-StatusHistoryKept:]
+	}
+	statusMutex.Unlock()
+
+	fyne.Do(func() {
+		statusLabel.SetText(msg.Text)
+		statusLight.FillColor = msg.Severity.Color()
+		statusLight.Refresh()
+		statusLabel.Refresh()
+		if historyChanged != nil {
+			historyChanged()
+		}
+	})
+
+	// Reset timer logic...
+	go func() {
+		time.Sleep(StatusTimeout * time.Second)
+		statusMutex.Lock()
+		isLast := lastMessageTime.Equal(msg.Time)
+		statusMutex.Unlock()
+
+		if isLast {
+			fyne.Do(func() {
+				statusLabel.SetText(StatusDefaultMessage)
+				statusLight.FillColor = ColorGreen
+				statusLight.Refresh()
+				statusLabel.Refresh()
+			})
+		}
+	}()
+}
+
+// ****************************************************************************
+// refreshHealth()
+// ****************************************************************************
+// Sets the health light to red when a target is down, to yellow when one is
+// unreachable, flapping or off its baseline, to green when all are up. The
+// paused targets are left out.
+func refreshHealth() {
+	up, total, paused, worst := 0, 0, 0, SeverityInfo
+	for _, m := range engine.Monitors() {
+		if m.Config.Paused {
+			paused++
+			continue
+		}
+		stats := m.Stats()
+		total++
+		switch {
+		case stats.State == StateDown:
+			worst = SeverityError
+		case stats.State == StateUnreachable || stats.Flapping || stats.Anomaly:
+			worst = max(worst, SeverityWarning)
+		}
+		if stats.State == StateUp {
+			up++
+		}
+	}
+
+	var fill color.Color = ColorGreen
+	switch {
+	case worst != SeverityInfo:
+		fill = worst.Color()
+	case up < total:
+		fill = ColorLightGrey // Some targets not probed yet
+	}
+	fyne.Do(func() {
+		healthLight.FillColor = fill
+		healthLight.Refresh()
+		text := fmt.Sprintf("%d/%d up", up, total)
+		if paused > 0 {
+			text += fmt.Sprintf(", %d paused", paused)
+		}
+		healthLabel.SetText(text)
+	})
+}
+
+// ****************************************************************************
+// showStatusHistory()
+// ****************************************************************************
+// Lists the past messages, the newest first, filtered by the search entry
+func showStatusHistory(parentWin fyne.Window) {
+	var shown []StatusMessage
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, container.NewCenter(lightSlot(newLight(ColorGreen))), nil, widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			msg := shown[id]
+			row := item.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			light := row.Objects[1].(*fyne.Container).Objects[0].(*fyne.Container).Objects[1].(*canvas.Circle)
+			label.SetText(fmt.Sprintf("%s  %s", msg.Time.Format("2006-01-02 15:04:05"), msg.Text))
+			light.FillColor = msg.Severity.Color()
+			light.Refresh()
+		},
+	)
+
+	search := widget.NewEntry()
+	search.PlaceHolder = "Search"
+	filter := func() {
+		query := strings.ToLower(search.Text)
+		statusMutex.Lock()
+		shown = shown[:0]
+		for idx := len(statusHistory) - 1; idx >= 0; idx-- {
+			msg := statusHistory[idx]
+			if strings.Contains(strings.ToLower(msg.Text), query) || msg.Severity.String() == query {
+				shown = append(shown, msg)
+			}
+		}
+		statusMutex.Unlock()
+		list.Refresh()
+	}
+	search.OnChanged = func(string) { filter() }
+	filter()
+
+	content := container.NewBorder(search, nil, nil, nil, list)
+	d := dialog.NewCustom("Messages", "Close", content, parentWin)
+	historyChanged = filter
+	d.SetOnClosed(func() { historyChanged = nil })
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
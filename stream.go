@@ -0,0 +1,350 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// StreamHub fans the engine events out to the streaming clients. Publishing
+// never blocks : a client whose buffer is full loses the event, and is told
+// how many it lost with the next one it gets.
+type StreamHub struct {
+	mu      sync.Mutex
+	clients map[*streamClient]bool
+}
+
+type streamClient struct {
+	events  chan Event
+	dropped atomic.Int64
+	targets map[string]bool // Addresses or names, empty for all
+	groups  map[string]bool // Empty for all
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var streamHub = &StreamHub{clients: make(map[*streamClient]bool)}
+
+// ****************************************************************************
+// Publish()
+// ****************************************************************************
+func (h *StreamHub) Publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.accepts(ev) {
+			continue
+		}
+		select {
+		case c.events <- ev:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+}
+
+// ****************************************************************************
+// subscribe()
+// ****************************************************************************
+// Registers a client filtered by the target and group query parameters
+func (h *StreamHub) subscribe(r *http.Request) *streamClient {
+	c := &streamClient{
+		events:  make(chan Event, StreamBuffer),
+		targets: make(map[string]bool),
+		groups:  make(map[string]bool),
+	}
+	for _, t := range r.URL.Query()["target"] {
+		c.targets[t] = true
+	}
+	for _, g := range r.URL.Query()["group"] {
+		c.groups[g] = true
+	}
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	return c
+}
+
+// ****************************************************************************
+// unsubscribe()
+// ****************************************************************************
+func (h *StreamHub) unsubscribe(c *streamClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// ****************************************************************************
+// accepts()
+// ****************************************************************************
+func (c *streamClient) accepts(ev Event) bool {
+	if len(c.targets) > 0 && !c.targets[ev.Address] && !c.targets[ev.Target] {
+		return false
+	}
+	if len(c.groups) > 0 && !c.groups[ev.Group] {
+		return false
+	}
+	return true
+}
+
+// ****************************************************************************
+// next()
+// ****************************************************************************
+// Returns the next event to send, preceded by a "dropped" notice when some
+// were lost since the previous one
+func (c *streamClient) next(ev Event) []Event {
+	if lost := c.dropped.Swap(0); lost > 0 {
+		notice := Event{
+			Time:    time.Now(),
+			Type:    "dropped",
+			Message: fmt.Sprintf("%d events dropped, the client is too slow", lost),
+		}
+		return []Event{notice, ev}
+	}
+	return []Event{ev}
+}
+
+// ****************************************************************************
+// publishEvents()
+// ****************************************************************************
+// Subscribes to the bus so that every sample and state transition reaches
+// the streaming clients, the transitions being logged and kept in the
+// incident log
+func publishEvents() {
+	s := bus.Subscribe("events")
+	incident := func(ev Event, warning bool) {
+		logEvent(ev, warning)
+		recordIncident(ev)
+		streamHub.Publish(ev)
+	}
+	On(s, &bus.Samples, func(r ProbeResult) {
+		ev := newEvent("sample", r.Monitor, "")
+		ev.Time, ev.RTT, ev.Lost = r.Sample.Time, r.Sample.RTT, r.Sample.Lost
+		streamHub.Publish(ev)
+	})
+	On(s, &bus.States, func(c StateChange) {
+		ev := newEvent("state", c.Monitor, stateMessage(c.Monitor, c.To))
+		ev.State = c.To.String()
+		if c.From == StateUnknown && c.To == StateUp {
+			logEvent(ev, false)
+			streamHub.Publish(ev)
+			return // First answer after a start, not an incident
+		}
+		incident(ev, c.To != StateUp)
+	})
+	On(s, &bus.Flaps, func(c FlapChange) {
+		incident(newEvent("flapping", c.Monitor, flapMessage(c.Monitor, c.Flapping)), c.Flapping)
+	})
+	On(s, &bus.Anomalies, func(c AnomalyChange) {
+		incident(newEvent("anomaly", c.Monitor, anomalyMessage(c.Monitor, c.Anomaly)), c.Anomaly)
+	})
+	On(s, &bus.Routes, func(c RouteChange) {
+		ev := newEvent("route", c.Monitor, routeMessage(c))
+		ev.Route = c.New
+		incident(ev, true)
+	})
+}
+
+// ****************************************************************************
+// serveSSE()
+// ****************************************************************************
+// Streams the events as Server-Sent Events, one "event:" per event type
+func serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	c := streamHub.subscribe(r)
+	defer streamHub.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(StreamKeepAlive * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-c.events:
+			for _, e := range c.next(ev) {
+				data, _ := json.Marshal(e)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// ****************************************************************************
+// serveWebSocket()
+// ****************************************************************************
+// Streams the events as JSON text messages over a WebSocket (RFC 6455)
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		writeError(w, http.StatusBadRequest, "expected a WebSocket upgrade")
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "WebSocket unsupported")
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if rw.Flush() != nil {
+		return
+	}
+
+	c := streamHub.subscribe(r)
+	defer streamHub.unsubscribe(c)
+
+	// The reader answers pings and notices when the client leaves
+	var writeMu sync.Mutex
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readWebSocketFrame(rw.Reader)
+			if err != nil || opcode == wsClose {
+				return
+			}
+			if opcode == wsPing {
+				writeMu.Lock()
+				writeWebSocketFrame(conn, wsPong, payload)
+				writeMu.Unlock()
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			writeMu.Lock()
+			writeWebSocketFrame(conn, wsClose, nil)
+			writeMu.Unlock()
+			return
+		case ev := <-c.events:
+			for _, e := range c.next(ev) {
+				data, _ := json.Marshal(e)
+				writeMu.Lock()
+				err := writeWebSocketFrame(conn, wsText, data)
+				writeMu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ****************************************************************************
+// WEBSOCKET FRAMES
+// ****************************************************************************
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// ****************************************************************************
+// writeWebSocketFrame()
+// ****************************************************************************
+// Writes one unmasked, unfragmented frame as a server must
+func writeWebSocketFrame(conn net.Conn, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	conn.SetWriteDeadline(time.Now().Add(StreamWriteTimeout * time.Second))
+	if _, err := conn.Write(header); err != nil {
+		return err
+	}
+	_, err := conn.Write(payload)
+	return err
+}
+
+// ****************************************************************************
+// readWebSocketFrame()
+// ****************************************************************************
+// Reads one client frame, which must be masked
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > StreamMaxFrame {
+		return 0, nil, fmt.Errorf("websocket frame of %d bytes is too large", length)
+	}
+
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked websocket frame from the client")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// maskedFrame()
+// ****************************************************************************
+// Encodes a frame as a client sends it
+func maskedFrame(opcode byte, payload []byte) []byte {
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(n))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// ****************************************************************************
+// readServerFrame()
+// ****************************************************************************
+// Reads a frame sent by pingo, which must be final and unmasked
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 != 0 {
+		t.Fatalf("frame header %v, want final and unmasked", head)
+	}
+	length := int(head[1])
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+// ****************************************************************************
+// waitStreamClients()
+// ****************************************************************************
+func waitStreamClients(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		streamHub.mu.Lock()
+		count := len(streamHub.clients)
+		streamHub.mu.Unlock()
+		if count == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d streaming clients, want %d", count, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ****************************************************************************
+// TestWebSocketFrames()
+// ****************************************************************************
+// The three payload length encodings, and the client frames which must be
+// masked and not too large
+func TestWebSocketFrames(t *testing.T) {
+	for _, c := range []struct {
+		size   int
+		header []byte
+	}{
+		{5, []byte{0x81, 5}},
+		{200, []byte{0x81, 126, 0, 200}},
+		{70000, []byte{0x81, 127, 0, 0, 0, 0, 0, 0x01, 0x11, 0x70}},
+	} {
+		payload := bytes.Repeat([]byte{'x'}, c.size)
+		server, client := net.Pipe()
+		go func() {
+			writeWebSocketFrame(server, wsText, payload)
+			server.Close()
+		}()
+		frame, _ := io.ReadAll(client)
+		if !bytes.HasPrefix(frame, c.header) || !bytes.Equal(frame[len(c.header):], payload) {
+			t.Errorf("%d bytes : frame starts with %v, want %v", c.size, frame[:min(len(frame), 10)], c.header)
+		}
+
+		if c.size > StreamMaxFrame {
+			if _, _, err := readWebSocketFrame(bufio.NewReader(bytes.NewReader(maskedFrame(wsText, payload)))); err == nil {
+				t.Errorf("%d bytes : frame larger than %d accepted", c.size, StreamMaxFrame)
+			}
+			continue
+		}
+		opcode, got, err := readWebSocketFrame(bufio.NewReader(bytes.NewReader(maskedFrame(wsPing, payload))))
+		if err != nil || opcode != wsPing || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes : read opcode %d, %d bytes, %v", c.size, opcode, len(got), err)
+		}
+	}
+
+	if _, _, err := readWebSocketFrame(bufio.NewReader(bytes.NewReader([]byte{0x81, 2, 'h', 'i'}))); err == nil {
+		t.Error("unmasked client frame accepted")
+	}
+}
+
+// ****************************************************************************
+// TestWebSocketStream()
+// ****************************************************************************
+// Upgrades with the RFC 6455 sample key, then gets the events of its
+// target, a pong and the closing handshake
+func TestWebSocketStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveWebSocket))
+	defer server.Close()
+	plain, err := http.Get(server.URL + "/api/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET : %s", plain.Status)
+	}
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "GET /api/ws?target=gateway HTTP/1.1\r\nHost: pingo\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake %s, accept %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	waitStreamClients(t, 1)
+	streamHub.Publish(Event{Type: "sample", Target: "router", Address: "192.0.2.2", RTT: 3})
+	streamHub.Publish(Event{Type: "sample", Target: "gateway", Address: "192.0.2.1", RTT: 12})
+	opcode, payload := readServerFrame(t, reader)
+	var ev Event
+	if err := json.Unmarshal(payload, &ev); err != nil || opcode != wsText {
+		t.Fatalf("opcode %d, %s : %v", opcode, payload, err)
+	}
+	if ev.Address != "192.0.2.1" || ev.RTT != 12 {
+		t.Errorf("event %+v, want the gateway sample only", ev)
+	}
+
+	conn.Write(maskedFrame(wsPing, []byte("hello")))
+	if opcode, payload := readServerFrame(t, reader); opcode != wsPong || string(payload) != "hello" {
+		t.Errorf("answer to ping %d %q", opcode, payload)
+	}
+	conn.Write(maskedFrame(wsClose, nil))
+	if opcode, _ := readServerFrame(t, reader); opcode != wsClose {
+		t.Errorf("answer to close %d", opcode)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after the close : %v", err)
+	}
+	waitStreamClients(t, 0)
+}
+
+// ****************************************************************************
+// TestSSEStream()
+// ****************************************************************************
+func TestSSEStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveSSE))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream?group=lan", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	waitStreamClients(t, 1)
+	streamHub.Publish(Event{Type: "state", Target: "dns", Address: "8.8.8.8", Group: "wan", State: "Down"})
+	streamHub.Publish(Event{Type: "state", Target: "nas", Address: "192.168.1.2", Group: "lan", State: "Down"})
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	var ev Event
+	if lines[0] != "event: state" || !strings.HasPrefix(lines[1], "data: ") || lines[2] != "" {
+		t.Fatalf("SSE lines %q", lines)
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &ev); err != nil || ev.Group != "lan" {
+		t.Errorf("event %+v, %v, want the lan one only", ev, err)
+	}
+
+	cancel()
+	waitStreamClients(t, 0)
+}
+
+// ****************************************************************************
+// TestStreamFilters()
+// ****************************************************************************
+func TestStreamFilters(t *testing.T) {
+	gateway := Event{Target: "gateway", Address: "192.0.2.1", Group: "lan"}
+	for _, c := range []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"target=gateway", true},
+		{"target=192.0.2.1", true},
+		{"target=dns&target=192.0.2.1", true},
+		{"target=dns", false},
+		{"group=lan", true},
+		{"group=wan", false},
+		{"target=gateway&group=wan", false},
+	} {
+		client := streamHub.subscribe(httptest.NewRequest(http.MethodGet, "/api/stream?"+c.query, nil))
+		streamHub.unsubscribe(client)
+		if got := client.accepts(gateway); got != c.want {
+			t.Errorf("%q accepts the gateway : %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestStreamDropped()
+// ****************************************************************************
+// A client not reading loses the events beyond its buffer, and is told how
+// many with the next one
+func TestStreamDropped(t *testing.T) {
+	c := streamHub.subscribe(httptest.NewRequest(http.MethodGet, "/api/stream", nil))
+	defer streamHub.unsubscribe(c)
+	for idx := range StreamBuffer + 3 {
+		streamHub.Publish(Event{Type: "sample", Target: "gateway", RTT: float64(idx)})
+	}
+	if len(c.events) != StreamBuffer || c.dropped.Load() != 3 {
+		t.Fatalf("%d events queued, %d dropped", len(c.events), c.dropped.Load())
+	}
+
+	events := c.next(<-c.events)
+	if len(events) != 2 || events[0].Type != "dropped" || !strings.HasPrefix(events[0].Message, "3 events dropped") || events[1].RTT != 0 {
+		t.Errorf("first events %+v", events)
+	}
+	if events := c.next(<-c.events); len(events) != 1 || events[0].RTT != 1 {
+		t.Errorf("next events %+v", events)
+	}
+}
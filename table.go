@@ -0,0 +1,225 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// tableRow is a target with the statistics it is sorted on, read once
+type tableRow struct {
+	monitor  *Monitor
+	hostname string
+	stats    TargetStats
+}
+
+// tableChanges are the changes waiting for the next frame
+type tableChanges struct {
+	rows   atomic.Bool // New samples to show
+	order  atomic.Bool // Targets added, removed or modified
+	health atomic.Bool // States changed
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var targetTable *widget.List
+var targetHeader *PingHeaderWidget
+var shownMonitors []*Monitor // Rows of the table, only used on the Fyne thread
+var columnsVersion int       // Bumped when the columns change, for the rows to follow
+var pendingChanges tableChanges
+
+// ****************************************************************************
+// createTargetTable()
+// ****************************************************************************
+// Builds the right panel : a filter, the column titles and a list which only
+// creates the rows that can be seen, bound to the targets as it scrolls
+func createTargetTable() fyne.CanvasObject {
+	loadColumns()
+	targetTable = widget.NewList(
+		func() int { return len(shownMonitors) },
+		func() fyne.CanvasObject { return NewPingWidget(deleteTarget) },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*PingWidget).Bind(shownMonitors[id])
+		},
+	)
+	targetTable.HideSeparators = true
+	targetTable.OnSelected = func(id widget.ListItemID) {
+		showTargetDetail(shownMonitors[id])
+		targetTable.UnselectAll() // The row is shown in bold instead
+	}
+
+	targetHeader = NewPingHeaderWidget()
+	targetHeader.OnSort = sortTargetRows
+	targetHeader.SetSort(settings.SortColumn, settings.SortDescending)
+
+	filterEntry := widget.NewEntry()
+	filterEntry.PlaceHolder = "Filter by name, address, group or tag"
+	filterEntry.SetText(settings.TargetFilter)
+	filterEntry.OnChanged = func(value string) {
+		settingsMutex.Lock()
+		settings.TargetFilter = value // Saved with the window geometry
+		settingsMutex.Unlock()
+		arrangeTargetRows()
+	}
+
+	arrangeTargetRows()
+	return container.NewBorder(container.NewVBox(filterEntry, targetHeader), nil, nil, nil, targetTable)
+}
+
+// ****************************************************************************
+// deleteTarget()
+// ****************************************************************************
+func deleteTarget(m *Monitor) {
+	engine.Remove(m.Config.Address)
+	saveTargets()
+	showStatus(fmt.Sprintf("%s deleted", m.DisplayName()))
+}
+
+// ****************************************************************************
+// runTableFrames()
+// ****************************************************************************
+// Redraws what changed at most UIFrameRate times per second, however many
+// probes ended in between
+func runTableFrames() {
+	ticker := time.NewTicker(time.Second / UIFrameRate)
+	defer ticker.Stop()
+	for range ticker.C {
+		rows := pendingChanges.rows.Swap(false)
+		order := pendingChanges.order.Swap(false)
+		if pendingChanges.health.Swap(false) {
+			refreshHealth()
+			refreshDependencyTree()
+		}
+		if rows || order {
+			fyne.Do(func() { drawTableFrame(rows, order) })
+		}
+	}
+}
+
+// ****************************************************************************
+// drawTableFrame()
+// ****************************************************************************
+// Refreshes the visible rows, sorting them again when the targets changed or
+// when they are sorted on a statistic
+func drawTableFrame(rows, order bool) {
+	if order || rows && sortedOnStats() {
+		arrangeTargetRows()
+	} else {
+		targetTable.Refresh()
+	}
+	refreshDetail()
+}
+
+// ****************************************************************************
+// arrangeTargetRows()
+// ****************************************************************************
+// Shows the rows matching the filter, in the order of the sorted column
+func arrangeTargetRows() {
+	shownMonitors = arrangeMonitors(engine.Monitors(), settings.TargetFilter, settings.SortColumn, settings.SortDescending)
+	targetTable.Refresh()
+}
+
+// ****************************************************************************
+// sortTargetRows()
+// ****************************************************************************
+// Called when a column title is clicked : sorts ascending, then descending,
+// then back to the order of the targets
+func sortTargetRows(column string) {
+	sortColumn, descending := column, false
+	switch {
+	case settings.SortColumn != column:
+	case !settings.SortDescending:
+		descending = true
+	default:
+		sortColumn = ""
+	}
+	updateSettings(func(s *AppSettings) { s.SortColumn, s.SortDescending = sortColumn, descending })
+	targetHeader.SetSort(settings.SortColumn, settings.SortDescending)
+	arrangeTargetRows()
+}
+
+// ****************************************************************************
+// sortedOnStats()
+// ****************************************************************************
+// Tells whether the order changes with the probes
+func sortedOnStats() bool {
+	switch settings.SortColumn {
+	case "", "name", "address":
+		return false
+	}
+	return true
+}
+
+// ****************************************************************************
+// arrangeMonitors()
+// ****************************************************************************
+// Returns the monitors matching the filter, sorted on the column, those equal
+// keeping the engine order
+func arrangeMonitors(monitors []*Monitor, filter, sortColumn string, descending bool) []*Monitor {
+	words := strings.Fields(strings.ToLower(filter))
+	rows := make([]tableRow, 0, len(monitors))
+	for _, m := range monitors {
+		row := tableRow{monitor: m, hostname: m.Hostname()}
+		if matchesFilter(row, words) {
+			rows = append(rows, row)
+		}
+	}
+
+	column, ok := findColumn(sortColumn)
+	if ok && column.Compare != nil {
+		for idx := range rows {
+			rows[idx].stats = rows[idx].monitor.Stats()
+		}
+		slices.SortStableFunc(rows, func(a, b tableRow) int {
+			if descending {
+				return column.Compare(b, a)
+			}
+			return column.Compare(a, b)
+		})
+	}
+
+	shown := make([]*Monitor, len(rows))
+	for idx, row := range rows {
+		shown[idx] = row.monitor
+	}
+	return shown
+}
+
+// ****************************************************************************
+// matchesFilter()
+// ****************************************************************************
+// A target matches when each word of the filter is found in its name,
+// address, group or one of its tags, ignoring case
+func matchesFilter(row tableRow, words []string) bool {
+	if len(words) == 0 {
+		return true
+	}
+	cfg := row.monitor.Config
+	fields := append([]string{row.hostname, cfg.Name, cfg.Address, cfg.Group}, cfg.Tags...)
+	for _, word := range words {
+		found := false
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+var benchInterval = flag.Int("table.interval", DefaultPingInterval, "seconds between two probes of a target, for BenchmarkTargetTable")
+var benchSort = flag.String("table.sort", "last", "column the table is sorted on, empty for none, for BenchmarkTargetTable")
+
+// ****************************************************************************
+// BenchmarkTargetTable()
+// ****************************************************************************
+// Measures a frame of the targets table where every target has a new
+// sample, in an offscreen window : go test -bench TargetTable [-table.sort last]
+func BenchmarkTargetTable(b *testing.B) {
+	if *benchInterval <= 0 {
+		b.Fatalf("interval must be a positive number of seconds, not %d", *benchInterval)
+	}
+	if _, ok := findColumn(*benchSort); !ok && *benchSort != "" {
+		b.Fatalf("unknown column %q", *benchSort)
+	}
+	test.NewApp()
+	settings.SortColumn = *benchSort
+	for _, n := range []int{100, 1000, 2000, 5000} {
+		b.Run(fmt.Sprintf("targets=%d", n), func(b *testing.B) { benchTable(b, n, *benchInterval) })
+	}
+}
+
+// ****************************************************************************
+// benchTable()
+// ****************************************************************************
+// Reports the UI time per second of UIFrameRate frames per second at most,
+// against one frame after each of the n probes of an interval
+func benchTable(b *testing.B, n, interval int) {
+	engine = NewEngine(time.Second)
+	for idx := range n {
+		engine.Add(TargetConfig{
+			Name:    fmt.Sprintf("host-%d", idx),
+			Address: fmt.Sprintf("10.%d.%d.%d", idx>>16&255, idx>>8&255, idx&255),
+			Group:   fmt.Sprintf("group-%d", idx%10),
+		})
+	}
+	probeAll := func() {
+		for _, m := range engine.Monitors() {
+			m.record(Sample{Time: time.Now(), RTT: 1 + rand.Float64()*100, Lost: rand.IntN(50) == 0}, false)
+		}
+	}
+	probeAll()
+
+	win := test.NewWindow(createTargetTable())
+	defer win.Close()
+	win.Resize(fyne.NewSize(1000, 700))
+
+	b.ReportAllocs()
+	for b.Loop() {
+		b.StopTimer()
+		probeAll()
+		b.StartTimer()
+		drawTableFrame(true, false)
+	}
+
+	frame := b.Elapsed() / time.Duration(b.N)
+	coalesced := frame * time.Duration(min(UIFrameRate, n/interval))
+	perProbe := frame * time.Duration(n) / time.Duration(interval)
+	b.ReportMetric(float64(coalesced)/float64(time.Millisecond), "ms-UI/s-coalesced")
+	b.ReportMetric(float64(perProbe)/float64(time.Millisecond), "ms-UI/s-per-probe")
+}
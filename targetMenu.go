@@ -0,0 +1,223 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// showTargetMenu()
+// ****************************************************************************
+// The context menu of a row, shown where it was right clicked
+func showTargetMenu(m *Monitor, pos fyne.Position) {
+	pause := "Pause"
+	if m.Config.Paused {
+		pause = "Resume"
+	}
+	silence := "Silence Alerts"
+	if _, ok := silencedUntil(m.Config.Address); ok {
+		silence = "Unsilence Alerts"
+	}
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem(pause, func() { toggleTargetPause(m) }),
+		fyne.NewMenuItem("Reset Statistics", func() { resetTargetStats(m) }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Edit...", func() { showTargetDialog(w, "Edit Target", m.Config, m.Config.Address) }),
+		fyne.NewMenuItem("Duplicate...", func() {
+			cfg := m.Config
+			cfg.Tags = append([]string(nil), cfg.Tags...)
+			showTargetDialog(w, "Duplicate Target", cfg, "")
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Copy Address", func() {
+			a.Clipboard().SetContent(m.Config.Address)
+			showStatus(m.Config.Address + " copied")
+		}),
+		fyne.NewMenuItem("Copy Statistics", func() {
+			a.Clipboard().SetContent(targetStatsText(m))
+			showStatus(fmt.Sprintf("Statistics of %s copied", m.DisplayName()))
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Open History", func() { showHistoryDialog(w, m) }),
+		fyne.NewMenuItem("Run Traceroute", func() { showTraceView(m) }),
+		fyne.NewMenuItem(silence, func() { toggleTargetSilence(m) }),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, w.Canvas(), pos)
+}
+
+// ****************************************************************************
+// toggleTargetPause()
+// ****************************************************************************
+// Stops probing a target until resumed, even after a restart
+func toggleTargetPause(m *Monitor) {
+	paused := !m.Config.Paused
+	engine.SetPaused(m.Config.Address, paused)
+	saveTargets()
+	if paused {
+		showStatus(m.DisplayName() + " paused")
+	} else {
+		showStatus(m.DisplayName() + " resumed")
+	}
+}
+
+// ****************************************************************************
+// pauseAllTargets()
+// ****************************************************************************
+func pauseAllTargets(paused bool) {
+	for _, m := range engine.Monitors() {
+		if m.Config.Paused != paused {
+			engine.SetPaused(m.Config.Address, paused)
+		}
+	}
+	saveTargets()
+	if paused {
+		showStatus("All targets paused")
+	} else {
+		showStatus("All targets resumed")
+	}
+}
+
+// ****************************************************************************
+// resetTargetStats()
+// ****************************************************************************
+func resetTargetStats(m *Monitor) {
+	m.ResetStats()
+	pendingChanges.rows.Store(true)
+	pendingChanges.health.Store(true)
+	showStatus(fmt.Sprintf("Statistics of %s reset", m.DisplayName()))
+}
+
+// ****************************************************************************
+// resetAllStats()
+// ****************************************************************************
+func resetAllStats() {
+	for _, m := range engine.Monitors() {
+		m.ResetStats()
+	}
+	pendingChanges.rows.Store(true)
+	pendingChanges.health.Store(true)
+	showStatus("Statistics of all targets reset")
+}
+
+// ****************************************************************************
+// toggleTargetSilence()
+// ****************************************************************************
+// Mutes the alerts of a target for SilenceDuration hours, or unmutes them
+func toggleTargetSilence(m *Monitor) {
+	address := m.Config.Address
+	if until, ok := silencedUntil(address); ok {
+		unsilenceTarget(address)
+		showStatus(fmt.Sprintf("%s unmuted (was muted until %s)", m.DisplayName(), until.Format("15:04")))
+	} else {
+		silenceTarget(address, SilenceDuration*time.Hour)
+		showStatus(fmt.Sprintf("%s muted for %dh", m.DisplayName(), SilenceDuration))
+	}
+	pendingChanges.rows.Store(true)
+}
+
+// ****************************************************************************
+// targetStatsText()
+// ****************************************************************************
+// The statistics of a target as plain text, for the clipboard
+func targetStatsText(m *Monitor) string {
+	stats := m.Stats()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", m.Hostname(), m.Config.Address)
+	fmt.Fprintf(&b, "State     : %s\n", stats.State)
+	fmt.Fprintf(&b, "Last      : %.1f ms\n", stats.Last)
+	fmt.Fprintf(&b, "Average   : %.1f ms\n", stats.Average)
+	fmt.Fprintf(&b, "Min / Max : %.1f / %.1f ms\n", stats.Min, stats.Max)
+	fmt.Fprintf(&b, "Jitter    : %.1f ms\n", stats.Jitter)
+	fmt.Fprintf(&b, "Lost      : %d of %d (%.1f %%)\n", stats.Lost, stats.Requests, stats.LossPercent())
+	fmt.Fprintf(&b, "MOS       : %.2f\n", stats.MOS())
+	return b.String()
+}
+
+// ****************************************************************************
+// showTargetDialog()
+// ****************************************************************************
+// Edits the target monitored at original, or adds a new one when original
+// is empty
+func showTargetDialog(parentWin fyne.Window, title string, cfg TargetConfig, original string) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(cfg.Name)
+	nameEntry.PlaceHolder = "Resolved from the address when empty"
+	addressEntry := widget.NewEntry()
+	addressEntry.SetText(cfg.Address)
+	addressEntry.Validator = func(value string) error {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			return errors.New("an address is required")
+		case value != original && engine.Find(value) != nil:
+			return fmt.Errorf("%s is already monitored", value)
+		}
+		return nil
+	}
+	parentEntry := widget.NewEntry()
+	parentEntry.SetText(cfg.Parent)
+	parentEntry.PlaceHolder = "Address of the target this one depends on"
+	groupEntry := widget.NewEntry()
+	groupEntry.SetText(cfg.Group)
+	tagsEntry := widget.NewEntry()
+	tagsEntry.SetText(strings.Join(cfg.Tags, ", "))
+	tagsEntry.PlaceHolder = "Comma separated"
+	traceCheck := widget.NewCheck("Trace the route to detect its changes", nil)
+	traceCheck.SetChecked(cfg.Trace)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Address", addressEntry),
+		widget.NewFormItem("Parent", parentEntry),
+		widget.NewFormItem("Group", groupEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Route", traceCheck),
+	}
+	d := dialog.NewForm(title, "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		cfg.Name = strings.TrimSpace(nameEntry.Text)
+		cfg.Address = strings.TrimSpace(addressEntry.Text)
+		cfg.Parent = strings.TrimSpace(parentEntry.Text)
+		cfg.Group = strings.TrimSpace(groupEntry.Text)
+		cfg.Trace = traceCheck.Checked
+		cfg.Tags = nil
+		for _, tag := range strings.Split(tagsEntry.Text, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				cfg.Tags = append(cfg.Tags, tag)
+			}
+		}
+
+		if original == "" {
+			m := engine.TryAdd(cfg)
+			if m == nil {
+				showError(cfg.Address + " is already monitored")
+				return
+			}
+			if !cfg.Paused {
+				m.Start()
+			}
+			showStatus(cfg.Address + " added")
+		} else {
+			if engine.Update(original, cfg) == nil {
+				showError(cfg.Address + " is already monitored or was removed")
+				return
+			}
+			showStatus(cfg.Address + " modified")
+		}
+		saveTargets()
+	}, parentWin)
+	d.Resize(fyne.NewSize(400, 0))
+	d.Show()
+}
@@ -0,0 +1,177 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"runtime"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var traceTitles = []string{"Hop", "Host", "Loss %", "Sent", "Last", "Avg", "Best", "Worst", "Jitter"}
+
+// ****************************************************************************
+// showTraceView()
+// ****************************************************************************
+// Opens a window tracing the route to a target continuously, one row per hop.
+// Closing the window stops the trace.
+func showTraceView(m *Monitor) {
+	win := a.NewWindow("Traceroute to " + m.DisplayName())
+
+	var cells [][]*ColoredLabel // By hop, then column
+	rows := container.NewVBox()
+	status := widget.NewLabel("")
+	draw := func(hops []HopStats, rounds int, err error) {
+		for len(cells) < len(hops) {
+			row := make([]*ColoredLabel, len(traceTitles))
+			objects := make([]fyne.CanvasObject, len(traceTitles))
+			for idx := range row {
+				row[idx] = NewColoredLabel("", ColorLightGrey, 11, fyne.TextAlignCenter, false)
+				objects[idx] = row[idx]
+			}
+			cells = append(cells, row)
+			rows.Add(container.NewGridWithColumns(len(traceTitles), objects...))
+		}
+		for idx, row := range rows.Objects {
+			if idx < len(hops) {
+				row.Show()
+			} else {
+				row.Hide() // The route got shorter
+			}
+		}
+		for idx, hop := range hops {
+			for column, label := range cells[idx] {
+				text, bg := traceCell(hop, column)
+				label.SetText(text)
+				label.SetColor(bg)
+			}
+		}
+		rows.Refresh()
+		if err != nil {
+			status.SetText(err.Error())
+		} else {
+			status.SetText(fmt.Sprintf("%d rounds", rounds))
+		}
+	}
+
+	protocols := make([]string, len(TraceProtocols))
+	for idx, protocol := range TraceProtocols {
+		protocols[idx] = strings.ToUpper(protocol)
+	}
+	protocolSelect := widget.NewSelect(protocols, nil)
+	if runtime.GOOS == "windows" {
+		protocolSelect.SetSelected("ICMP")
+	} else {
+		protocolSelect.SetSelected("UDP") // The only one traceroute sends without privileges
+	}
+
+	var cancel context.CancelFunc
+	var startButton *widget.Button
+	stop := func() {
+		if cancel != nil {
+			cancel()
+			cancel = nil
+		}
+		startButton.SetText("Start")
+	}
+	start := func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		tracer := NewTracer(m.Config.Address, strings.ToLower(protocolSelect.Selected))
+		draw(nil, 0, nil)
+		status.SetText("Tracing...")
+		startButton.SetText("Stop")
+		go tracer.Run(ctx, func(hops []HopStats, err error) {
+			rounds := tracer.Rounds()
+			fyne.Do(func() {
+				if ctx.Err() == nil {
+					draw(hops, rounds, err)
+				}
+			})
+		})
+	}
+	startButton = widget.NewButton("Start", func() {
+		if cancel != nil {
+			stop()
+		} else {
+			start()
+		}
+	})
+	protocolSelect.OnChanged = func(string) {
+		if cancel != nil {
+			stop()
+			start()
+		}
+	}
+	win.SetOnClosed(stop)
+
+	header := make([]fyne.CanvasObject, len(traceTitles))
+	for idx, title := range traceTitles {
+		header[idx] = NewColoredLabel(title, ColorDarkGrey, 11, fyne.TextAlignCenter, true)
+	}
+	top := container.NewVBox(
+		container.NewBorder(nil, nil, container.NewHBox(protocolSelect, startButton), nil, status),
+		container.NewGridWithColumns(len(traceTitles), header...),
+	)
+	win.SetContent(container.NewBorder(top, nil, nil, nil, container.NewVScroll(rows)))
+	win.Resize(fyne.NewSize(820, 500))
+	win.Show()
+	start()
+}
+
+// ****************************************************************************
+// traceCell()
+// ****************************************************************************
+// Returns the text and the color of a column of a hop, the loss going from
+// green to red
+func traceCell(hop HopStats, column int) (string, color.Color) {
+	answered := hop.Requests > hop.Lost
+	rtt := func(v float64) (string, color.Color) {
+		if !answered {
+			return "-", ColorLightGrey
+		}
+		return fmt.Sprintf("%.1f", v), ColorLightGrey
+	}
+	switch column {
+	case 0:
+		return fmt.Sprintf("%d", hop.TTL), ColorLightGrey
+	case 1:
+		if hop.Address == "" {
+			return "???", ColorLightGrey
+		}
+		return hop.Address, ColorLightBlue
+	case 2:
+		loss := hop.LossPercent()
+		switch {
+		case loss == 0:
+			return "0.0", ColorGreen
+		case loss < TraceLossWarning:
+			return fmt.Sprintf("%.1f", loss), ColorYellow
+		default:
+			return fmt.Sprintf("%.1f", loss), ColorRed
+		}
+	case 3:
+		return fmt.Sprintf("%d", hop.Requests), ColorLightGrey
+	case 4:
+		return rtt(hop.Last)
+	case 5:
+		return rtt(hop.Average)
+	case 6:
+		return rtt(hop.Min)
+	case 7:
+		return rtt(hop.Max)
+	case 8:
+		return rtt(hop.Jitter)
+	}
+	return "", ColorLightGrey
+}
@@ -0,0 +1,197 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// TraceProbe is the answer, or the lack of answer, to one probe of a hop
+type TraceProbe struct {
+	TTL     int
+	Address string // Empty when lost
+	RTT     float64
+	Lost    bool
+}
+
+// HopStats are the statistics of a hop over the rounds of a trace, Min and
+// Max being the best and the worst RTT
+type HopStats struct {
+	TTL     int
+	Address string // Last router which answered, empty while none did
+	TargetStats
+}
+
+// Tracer runs the traceroute of the system towards a target again and again,
+// as mtr does
+type Tracer struct {
+	Address  string
+	Protocol string // "icmp", "udp" or "tcp"
+	mu       sync.Mutex
+	hops     []HopStats // By TTL, from 1
+	rounds   int
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+var TraceProtocols = []string{"icmp", "udp", "tcp"}
+
+// ****************************************************************************
+// traceroute()
+// ****************************************************************************
+// Runs one traceroute and returns the probes of each hop
+func traceroute(ctx context.Context, address, protocol string) ([]TraceProbe, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		if protocol != "icmp" {
+			return nil, fmt.Errorf("tracert only sends ICMP, %s is not available", protocol)
+		}
+		cmd = exec.CommandContext(ctx, "tracert", "-d",
+			"-h", strconv.Itoa(TraceMaxHops), "-w", strconv.Itoa(TraceWait*1000), address)
+	} else {
+		args := []string{"-n", "-q", "1", "-w", strconv.Itoa(TraceWait), "-m", strconv.Itoa(TraceMaxHops)}
+		switch protocol {
+		case "icmp":
+			args = append(args, "-I")
+		case "tcp":
+			args = append(args, "-T")
+		}
+		cmd = exec.CommandContext(ctx, "traceroute", append(args, address)...)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) > 0 {
+			return nil, fmt.Errorf("traceroute failed : %s", strings.TrimSpace(string(out)))
+		}
+		return nil, fmt.Errorf("traceroute failed : %w", err)
+	}
+	return parseTraceroute(string(out)), nil
+}
+
+// ****************************************************************************
+// parseTraceroute()
+// ****************************************************************************
+// Reads the output of traceroute or tracert, one line per hop starting with
+// its TTL followed by the address and the RTT of each probe, "*" when lost
+func parseTraceroute(output string) []TraceProbe {
+	var probes []TraceProbe
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ttl, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue // Header or message
+		}
+		// An RTT belongs to the address before it, as traceroute prints
+		// them, or after it as tracert does
+		address := ""
+		var hop []TraceProbe
+		for _, field := range fields[1:] {
+			if field == "*" {
+				hop = append(hop, TraceProbe{TTL: ttl, Lost: true})
+			} else if ip := net.ParseIP(strings.Trim(field, "[]()")); ip != nil {
+				address = ip.String()
+				for idx := range hop {
+					if !hop[idx].Lost && hop[idx].Address == "" {
+						hop[idx].Address = address
+					}
+				}
+			} else if rtt, err := strconv.ParseFloat(strings.TrimPrefix(field, "<"), 64); err == nil {
+				hop = append(hop, TraceProbe{TTL: ttl, Address: address, RTT: rtt})
+			}
+		}
+		probes = append(probes, hop...)
+	}
+	return probes
+}
+
+// ****************************************************************************
+// NewTracer()
+// ****************************************************************************
+func NewTracer(address, protocol string) *Tracer {
+	return &Tracer{Address: address, Protocol: protocol}
+}
+
+// ****************************************************************************
+// Run()
+// ****************************************************************************
+// Traces the route until the context is cancelled, calling round after each
+// traceroute with the statistics of the hops or the error
+func (t *Tracer) Run(ctx context.Context, round func(hops []HopStats, err error)) {
+	for {
+		roundCtx, cancel := context.WithTimeout(ctx, TracerouteTimeout*time.Second)
+		probes, err := traceroute(roundCtx, t.Address, t.Protocol)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			t.record(probes)
+		}
+		round(t.Hops(), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(TraceInterval * time.Second):
+		}
+	}
+}
+
+// ****************************************************************************
+// record()
+// ****************************************************************************
+func (t *Tracer) record(probes []TraceProbe) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rounds++
+	for _, probe := range probes {
+		for len(t.hops) < probe.TTL {
+			t.hops = append(t.hops, HopStats{TTL: len(t.hops) + 1})
+		}
+		hop := &t.hops[probe.TTL-1]
+		hop.Requests++
+		if probe.Lost {
+			hop.Lost++
+			continue
+		}
+		hop.Address = probe.Address
+		hop.addAnswer(probe.RTT)
+	}
+}
+
+// ****************************************************************************
+// Hops()
+// ****************************************************************************
+func (t *Tracer) Hops() []HopStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]HopStats(nil), t.hops...)
+}
+
+// ****************************************************************************
+// Rounds()
+// ****************************************************************************
+func (t *Tracer) Rounds() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rounds
+}
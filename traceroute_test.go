@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// ****************************************************************************
+// TestParseTraceroute()
+// ****************************************************************************
+func TestParseTraceroute(t *testing.T) {
+	lost := func(ttl int) TraceProbe { return TraceProbe{TTL: ttl, Lost: true} }
+	for _, c := range []struct {
+		name   string
+		output string
+		want   []TraceProbe
+	}{
+		{"linux", `traceroute to 8.8.8.8 (8.8.8.8), 30 hops max, 60 byte packets
+ 1  192.168.1.1  0.512 ms
+ 2  *
+ 3  10.0.0.1  5.1 ms !H
+ 4  8.8.8.8  12.25 ms
+`, []TraceProbe{
+			{TTL: 1, Address: "192.168.1.1", RTT: 0.512},
+			lost(2),
+			{TTL: 3, Address: "10.0.0.1", RTT: 5.1},
+			{TTL: 4, Address: "8.8.8.8", RTT: 12.25},
+		}},
+		{"linux, routers sharing a hop", ` 1  10.0.0.1  1.2 ms 10.0.0.2  1.5 ms *
+ 2  * * *
+`, []TraceProbe{
+			{TTL: 1, Address: "10.0.0.1", RTT: 1.2},
+			{TTL: 1, Address: "10.0.0.2", RTT: 1.5},
+			lost(1),
+			lost(2), lost(2), lost(2),
+		}},
+		{"linux, IPv6", `traceroute to 2001:4860:4860::8888 (2001:4860:4860::8888), 30 hops max, 80 byte packets
+ 1  2001:db8::1  0.4 ms
+ 2  2001:4860:4860::8888  9 ms
+`, []TraceProbe{
+			{TTL: 1, Address: "2001:db8::1", RTT: 0.4},
+			{TTL: 2, Address: "2001:4860:4860::8888", RTT: 9},
+		}},
+		{"windows", "\r\nTracing route to 8.8.8.8 over a maximum of 30 hops\r\n\r\n" +
+			"  1    <1 ms    <1 ms    <1 ms  192.168.1.1\r\n" +
+			"  2     *        *        *     Request timed out.\r\n" +
+			"  3    12 ms     *       11 ms  [10.1.1.1]\r\n" +
+			"\r\nTrace complete.\r\n", []TraceProbe{
+			{TTL: 1, Address: "192.168.1.1", RTT: 1},
+			{TTL: 1, Address: "192.168.1.1", RTT: 1},
+			{TTL: 1, Address: "192.168.1.1", RTT: 1},
+			lost(2), lost(2), lost(2),
+			{TTL: 3, Address: "10.1.1.1", RTT: 12},
+			lost(3),
+			{TTL: 3, Address: "10.1.1.1", RTT: 11},
+		}},
+		{"windows, IPv6", "  1     1 ms    <1 ms     2 ms  2001:db8::1\r\n", []TraceProbe{
+			{TTL: 1, Address: "2001:db8::1", RTT: 1},
+			{TTL: 1, Address: "2001:db8::1", RTT: 1},
+			{TTL: 1, Address: "2001:db8::1", RTT: 2},
+		}},
+		{"no hop", "traceroute: unknown host nowhere\n", nil},
+	} {
+		if got := parseTraceroute(c.output); !slices.Equal(got, c.want) {
+			t.Errorf("%s :\n got %+v\nwant %+v", c.name, got, c.want)
+		}
+	}
+}
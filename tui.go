@@ -0,0 +1,431 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ****************************************************************************
+// TYPES
+// ****************************************************************************
+// TerminalDashboard is the text equivalent of the right panel, for SSH sessions
+type TerminalDashboard struct {
+	mu         sync.Mutex
+	selected   int
+	top        int // First row shown when the targets do not fit the terminal
+	sortColumn int // Index in TerminalColumns, -1 keeps the insertion order
+	descending bool
+	prompt     string // Non empty while typing the address of a new target
+	input      string
+	message    string
+	quit       chan struct{}
+}
+
+type TerminalColumn struct {
+	Title string
+	Width int
+}
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+// Same columns as PingHeaderWidget, the Action column being the key bindings
+var TerminalColumns = []TerminalColumn{
+	{"Hostname", 24},
+	{"Address", 18},
+	{"Lost", 8},
+	{"Ping", 12},
+	{"Average", 9},
+	{"Min", 9},
+	{"Max", 9},
+	{"Requests", 11},
+}
+
+// ANSI background colors of the ping cell, matching the GUI rows
+const (
+	ansiReset     = "\x1b[0m"
+	ansiGreen     = "\x1b[42;30m"
+	ansiRed       = "\x1b[41;97m"
+	ansiYellow    = "\x1b[103;30m"
+	ansiOrange    = "\x1b[48;5;208;30m"
+	ansiDarkYel   = "\x1b[43;97m"
+	ansiGrey      = "\x1b[47;30m"
+	ansiReverse   = "\x1b[7m"
+	ansiBold      = "\x1b[1m"
+	ansiClear     = "\x1b[H\x1b[2J"
+	ansiAltScreen = "\x1b[?1049h\x1b[?25l"
+	ansiMainScrn  = "\x1b[?25h\x1b[?1049l"
+)
+
+// ****************************************************************************
+// runTerminalDashboard()
+// ****************************************************************************
+func runTerminalDashboard(opts Options) int {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "the terminal dashboard needs an interactive terminal")
+		return 2
+	}
+
+	var err error
+	settings, err = loadSettings()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "cannot read settings : %v\n", err)
+		return 1
+	}
+	if err := startLogging(settings, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if opts.Interval > 0 {
+		settings.PingInterval = opts.Interval
+	}
+	engine = newEngineFromSettings(nil)
+
+	if err := startServices(engine); err != nil {
+		fmt.Fprintln(os.Stderr, err) // Shown again once the dashboard quits
+	}
+
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot set the terminal in raw mode : %v\n", err)
+		return 1
+	}
+	fmt.Print(ansiAltScreen)
+	defer func() {
+		fmt.Print(ansiMainScrn)
+		term.Restore(fd, oldState)
+	}()
+
+	engine.StartAll()
+
+	d := &TerminalDashboard{sortColumn: -1, quit: make(chan struct{})}
+	go d.readKeys()
+	ticker := time.NewTicker(TerminalRefresh * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-d.quit:
+			for _, m := range engine.Monitors() {
+				m.Stop()
+			}
+			saveTargets()
+			saveBaselines(engine)
+			stopServices()
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// ****************************************************************************
+// sortedMonitors()
+// ****************************************************************************
+func (d *TerminalDashboard) sortedMonitors() []*Monitor {
+	monitors := engine.Monitors()
+	if d.sortColumn < 0 {
+		return monitors
+	}
+	sort.SliceStable(monitors, func(i, j int) bool {
+		a, b := terminalCell(monitors[i], d.sortColumn, true), terminalCell(monitors[j], d.sortColumn, true)
+		if d.descending {
+			return a > b
+		}
+		return a < b
+	})
+	return monitors
+}
+
+// ****************************************************************************
+// terminalCell()
+// ****************************************************************************
+// Returns the text of a column, zero padded when used as a sort key so that
+// numbers compare as strings
+func terminalCell(m *Monitor, column int, sortKey bool) string {
+	stats := m.Stats()
+	number := func(v float64) string {
+		if sortKey {
+			return fmt.Sprintf("%012.3f", v)
+		}
+		return fmt.Sprintf("%.1f", v)
+	}
+	integer := func(v int) string {
+		if sortKey {
+			return fmt.Sprintf("%012d", v)
+		}
+		return fmt.Sprintf("%d", v)
+	}
+	switch column {
+	case 0:
+		return m.Hostname()
+	case 1:
+		return m.Config.Address
+	case 2:
+		return integer(stats.Lost)
+	case 3:
+		if m.Config.Paused {
+			return "paused"
+		} else if stats.Flapping {
+			return "flapping"
+		} else if stats.State == StateUnreachable {
+			return "parent down"
+		}
+		return number(stats.Last)
+	case 4:
+		return number(stats.Average)
+	case 5:
+		return number(stats.Min)
+	case 6:
+		return number(stats.Max)
+	case 7:
+		return integer(stats.Requests)
+	}
+	return ""
+}
+
+// ****************************************************************************
+// pingColor()
+// ****************************************************************************
+func pingColor(m *Monitor) string {
+	stats := m.Stats()
+	switch {
+	case m.Config.Paused:
+		return ansiGrey
+	case stats.Flapping:
+		return ansiOrange
+	case stats.State == StateDown:
+		return ansiRed
+	case stats.State == StateUnreachable:
+		return ansiDarkYel
+	case stats.State == StateUp && stats.Anomaly:
+		return ansiYellow
+	case stats.State == StateUp:
+		return ansiGreen
+	}
+	return ansiGrey
+}
+
+// ****************************************************************************
+// draw()
+// ****************************************************************************
+func (d *TerminalDashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	monitors := d.sortedMonitors()
+	if d.selected >= len(monitors) {
+		d.selected = len(monitors) - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+	first, last := 0, len(monitors)
+	if _, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		first, last = d.window(len(monitors), height-TerminalReservedRows)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	fmt.Fprint(out, ansiClear)
+	fmt.Fprintf(out, "%s%s - v%s%s", ansiBold, AppTitle, GetDisplayVersion(), ansiReset)
+	if first > 0 || last < len(monitors) {
+		fmt.Fprintf(out, "  targets %d-%d of %d", first+1, last, len(monitors))
+	}
+	fmt.Fprint(out, "\r\n\r\n")
+
+	// Header, the sorted column being marked by an arrow
+	var header strings.Builder
+	for idx, col := range TerminalColumns {
+		title := col.Title
+		if idx == d.sortColumn {
+			if d.descending {
+				title += " v"
+			} else {
+				title += " ^"
+			}
+		}
+		header.WriteString(padCell(title, col.Width))
+	}
+	fmt.Fprintf(out, "%s%s%s\r\n", ansiBold, header.String(), ansiReset)
+
+	for row := first; row < last; row++ {
+		m := monitors[row]
+		line := ""
+		for idx, col := range TerminalColumns {
+			cell := padCell(terminalCell(m, idx, false), col.Width)
+			if idx == 3 {
+				cell = pingColor(m) + cell + ansiReset
+				if row == d.selected {
+					cell += ansiReverse
+				}
+			}
+			line += cell
+		}
+		if row == d.selected {
+			line = ansiReverse + line + ansiReset
+		}
+		fmt.Fprint(out, line+"\r\n")
+	}
+
+	fmt.Fprint(out, "\r\n")
+	if d.prompt != "" {
+		fmt.Fprintf(out, "%s%s\x1b[?25h", d.prompt, d.input)
+		return
+	}
+	fmt.Fprint(out, "\x1b[?25l")
+	if d.message != "" {
+		fmt.Fprintf(out, "%s\r\n", d.message)
+	}
+	fmt.Fprint(out, "[a]dd  [p]ause/resume  [d]elete  [s]ort column  [r]everse  [up/down] select  [q]uit")
+}
+
+// ****************************************************************************
+// window()
+// ****************************************************************************
+// Returns the range of the rows shown when only visible of them fit,
+// scrolled no more than needed to show the selected one
+func (d *TerminalDashboard) window(rows, visible int) (int, int) {
+	visible = max(1, visible)
+	if d.selected < d.top {
+		d.top = d.selected
+	} else if d.selected >= d.top+visible {
+		d.top = d.selected - visible + 1
+	}
+	d.top = max(0, min(d.top, rows-visible))
+	return d.top, min(rows, d.top+visible)
+}
+
+// ****************************************************************************
+// padCell()
+// ****************************************************************************
+func padCell(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) >= width {
+		return string(runes[:width-1]) + " "
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// ****************************************************************************
+// readKeys()
+// ****************************************************************************
+func (d *TerminalDashboard) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(d.quit)
+			return
+		}
+		if d.handleKey(string(buf[:n])) {
+			close(d.quit)
+			return
+		}
+		d.draw()
+	}
+}
+
+// ****************************************************************************
+// handleKey()
+// ****************************************************************************
+// Returns true when the dashboard must quit
+func (d *TerminalDashboard) handleKey(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.prompt != "" {
+		d.handlePromptKey(key)
+		return false
+	}
+
+	d.message = ""
+	monitors := d.sortedMonitors()
+	var current *Monitor
+	if d.selected >= 0 && d.selected < len(monitors) {
+		current = monitors[d.selected]
+	}
+
+	switch key {
+	case "q", "\x03": // Ctrl-C is not a signal in raw mode
+		return true
+	case "\x1b[A", "k":
+		if d.selected > 0 {
+			d.selected--
+		}
+	case "\x1b[B", "j":
+		if d.selected < len(monitors)-1 {
+			d.selected++
+		}
+	case "a":
+		d.prompt = "Address to add ([name=]address) : "
+		d.input = ""
+	case "p":
+		if current == nil {
+			break
+		}
+		paused := !current.Config.Paused
+		engine.SetPaused(current.Config.Address, paused)
+		saveTargets()
+		if paused {
+			d.message = current.DisplayName() + " paused"
+		} else {
+			d.message = current.DisplayName() + " resumed"
+		}
+	case "d":
+		if current == nil {
+			break
+		}
+		engine.Remove(current.Config.Address)
+		saveTargets()
+		d.message = current.DisplayName() + " deleted"
+	case "s":
+		d.sortColumn++
+		if d.sortColumn >= len(TerminalColumns) {
+			d.sortColumn = -1
+		}
+	case "r":
+		d.descending = !d.descending
+	}
+	return false
+}
+
+// ****************************************************************************
+// handlePromptKey()
+// ****************************************************************************
+func (d *TerminalDashboard) handlePromptKey(key string) {
+	switch key {
+	case "\x1b", "\x03": // Escape or Ctrl-C cancels
+		d.prompt = ""
+	case "\r", "\n":
+		d.prompt = ""
+		input := strings.TrimSpace(d.input)
+		if input == "" {
+			return
+		}
+		target := parseTargets([]string{input})[0]
+		if engine.Find(target.Address) != nil {
+			d.message = target.Address + " is already monitored"
+			return
+		}
+		engine.Add(target).Start()
+		saveTargets()
+		d.message = target.Address + " added"
+	case "\x7f", "\b":
+		if runes := []rune(d.input); len(runes) > 0 {
+			d.input = string(runes[:len(runes)-1])
+		}
+	default:
+		if key[0] >= 0x20 && key[0] != 0x7f {
+			d.input += key
+		}
+	}
+}
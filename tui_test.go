@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ****************************************************************************
+// TestTerminalWindow()
+// ****************************************************************************
+// Moving the selection scrolls the rows only when it leaves the window
+func TestTerminalWindow(t *testing.T) {
+	d := &TerminalDashboard{}
+	for _, c := range []struct {
+		selected, rows, visible int
+		first, last             int
+	}{
+		{0, 5, 10, 0, 5},
+		{0, 50, 10, 0, 10},
+		{9, 50, 10, 0, 10},
+		{10, 50, 10, 1, 11},
+		{30, 50, 10, 21, 31},
+		{25, 50, 10, 21, 31},
+		{20, 50, 10, 20, 30},
+		{49, 50, 10, 40, 50},
+		{49, 50, 20, 30, 50},
+		{5, 6, 0, 5, 6},
+		{2, 3, 10, 0, 3},
+	} {
+		d.selected = c.selected
+		if first, last := d.window(c.rows, c.visible); first != c.first || last != c.last {
+			t.Errorf("row %d of %d, %d visible : rows %d-%d, want %d-%d",
+				c.selected, c.rows, c.visible, first, last, c.first, c.last)
+		}
+	}
+}
+
+// ****************************************************************************
+// TestTerminalPaused()
+// ****************************************************************************
+// A paused target shows as paused even before the engine runs
+func TestTerminalPaused(t *testing.T) {
+	e := NewEngine(time.Second)
+	paused := e.Add(TargetConfig{Address: "192.0.2.1", Paused: true})
+	active := e.Add(TargetConfig{Address: "192.0.2.2"})
+	if cell, color := terminalCell(paused, 3, false), pingColor(paused); cell != "paused" || color != ansiGrey {
+		t.Errorf("paused target : %q", cell)
+	}
+	if cell := terminalCell(active, 3, false); cell == "paused" {
+		t.Errorf("active target : %q", cell)
+	}
+}
@@ -2,12 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
-
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/dialog"
 )
 
 // This is the major version
@@ -58,19 +56,18 @@ func fetchRemoteHash() (string, error) {
 // ****************************************************************************
 // checkForUpdates()
 // ****************************************************************************
-func checkForUpdates(w fyne.Window) {
+// Publishes an UpdateAvailable event when GitHub has a newer version
+func checkForUpdates() {
 	remoteHash, err := fetchRemoteHash()
 	if err != nil {
-		// Silently fail or log error to avoid bothering user on offline mode
+		// Only logged to avoid bothering the user in offline mode
+		slog.Info("update check failed", "error", err)
 		return
 	}
 
 	// We assume your 'Version' string ends with the hash (e.g., "0.5-abcdef")
 	// We check if the remote hash is present in our local Version string
 	if !strings.Contains(Version, remoteHash) {
-		dialog.ShowInformation("Update Available",
-			"A new version is available on GitHub!\nRemote Hash: "+remoteHash,
-			w)
-		showStatus("A new version is available on GitHub")
+		bus.Updates.Publish(UpdateAvailable{Remote: remoteHash})
 	}
 }
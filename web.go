@@ -0,0 +1,50 @@
+package main
+
+// ****************************************************************************
+// IMPORTS
+// ****************************************************************************
+import (
+	"embed"
+	"io/fs"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ****************************************************************************
+// GLOBALS
+// ****************************************************************************
+// The dashboard pages are built into the binary so that it works offline
+//
+//go:embed web
+var webAssets embed.FS
+
+// ****************************************************************************
+// startWebServer()
+// ****************************************************************************
+// Serves the read-only web dashboard, returns once listening. Like the
+// metrics endpoint it needs no token, nothing can be changed from it.
+func startWebServer(e *Engine, address string, port int) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, newWebHandler(e))
+	return nil
+}
+
+// ****************************************************************************
+// newWebHandler()
+// ****************************************************************************
+func newWebHandler(e *Engine) *http.ServeMux {
+	mux := http.NewServeMux()
+	assets, _ := fs.Sub(webAssets, "web")
+	mux.Handle("GET /", http.FileServerFS(assets))
+
+	// Same data as the REST API, without any of its write access
+	mux.HandleFunc("GET /data/targets", listTargets(e))
+	mux.HandleFunc("GET /data/targets/{address}/history", targetHistory(e))
+	mux.HandleFunc("GET /data/incidents", listIncidents)
+	mux.HandleFunc("GET /data/stream", serveSSE)
+	return mux
+}
@@ -0,0 +1,245 @@
+// Pingo web dashboard : read-only view of the targets, fed by /data/*
+"use strict";
+
+const ChartWindow = 60 * 60 * 1000; // Milliseconds of history drawn
+const RefreshDelay = 1000;          // Milliseconds between two table refreshes
+const IncidentsShown = 100;
+
+let selected = null; // Address of the charted target
+let samples = [];    // Its samples, oldest first
+let routes = [];     // Times of its route changes
+let refreshPending = false;
+
+// ****************************************************************************
+// Data
+// ****************************************************************************
+async function fetchJSON(path) {
+  const response = await fetch(path);
+  if (!response.ok) {
+    throw new Error(path + " : " + response.status);
+  }
+  return response.json();
+}
+
+function scheduleRefresh() {
+  if (refreshPending) {
+    return;
+  }
+  refreshPending = true;
+  setTimeout(() => {
+    refreshPending = false;
+    refreshTargets();
+    refreshIncidents();
+  }, RefreshDelay);
+}
+
+// ****************************************************************************
+// Targets table
+// ****************************************************************************
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+// Same rules as PingWidget.Update()
+function pingCell(t) {
+  const s = t.stats;
+  if (!t.running) {
+    return cell("paused", "number paused");
+  }
+  if (s.flapping) {
+    return cell("flapping", "number flapping");
+  }
+  switch (s.state) {
+    case "up":
+      return cell(s.last.toFixed(1), "number " + (s.anomaly ? "anomaly" : "up"));
+    case "down":
+      return cell("down", "number down");
+    case "unreachable due to parent":
+      return cell("parent down", "number unreachable");
+  }
+  return cell("", "number unknown");
+}
+
+async function refreshTargets() {
+  let targets;
+  try {
+    targets = await fetchJSON("data/targets");
+  } catch (err) {
+    return;
+  }
+  const body = document.querySelector("#targets tbody");
+  body.replaceChildren();
+  for (const t of targets) {
+    const row = document.createElement("tr");
+    if (t.address === selected) {
+      row.className = "selected";
+    }
+    const silenced = t.silenced ? "silenced" : "";
+    row.append(
+      cell(t.hostname || t.name || t.address),
+      cell(t.address, silenced),
+      cell(t.group || ""),
+      cell(t.stats.lost, "number"),
+      pingCell(t),
+      cell(t.stats.average.toFixed(1), "number"),
+      cell(t.stats.min.toFixed(1), "number"),
+      cell(t.stats.max.toFixed(1), "number"),
+      cell(t.stats.requests, "number"),
+    );
+    row.addEventListener("click", () => select(t));
+    body.append(row);
+  }
+}
+
+// ****************************************************************************
+// Target detail
+// ****************************************************************************
+async function select(t) {
+  if (selected === t.address) {
+    selected = null;
+    document.querySelector("#detail").hidden = true;
+  } else {
+    selected = t.address;
+    document.querySelector("#detail-title").textContent = t.name || t.hostname || t.address;
+    document.querySelector("#detail").hidden = false;
+    samples = [];
+    routes = [];
+    try {
+      samples = await fetchJSON("data/targets/" + encodeURIComponent(t.address) + "/history?since=1h");
+    } catch (err) {
+      // Keep an empty chart, live samples will fill it
+    }
+    drawChart();
+  }
+  refreshTargets();
+  refreshIncidents();
+}
+
+function drawChart() {
+  const canvas = document.querySelector("#chart");
+  const ctx = canvas.getContext("2d");
+  const width = canvas.width, height = canvas.height, margin = 40;
+  ctx.clearRect(0, 0, width, height);
+
+  const now = Date.now();
+  samples = samples.filter(s => now - Date.parse(s.time) <= ChartWindow);
+  const max = Math.max(1, ...samples.filter(s => !s.lost).map(s => s.rtt)) * 1.1;
+  const x = t => margin + (width - margin) * (1 - (now - Date.parse(t)) / ChartWindow);
+  const y = rtt => height - margin / 2 - (height - margin) * rtt / max;
+
+  // Axes and scale
+  ctx.strokeStyle = "rgb(220, 227, 232)";
+  ctx.fillStyle = "rgb(100, 100, 100)";
+  ctx.font = "11px sans-serif";
+  for (const fraction of [0, 0.5, 1]) {
+    const rtt = max * fraction;
+    ctx.beginPath();
+    ctx.moveTo(margin, y(rtt));
+    ctx.lineTo(width, y(rtt));
+    ctx.stroke();
+    ctx.fillText(rtt.toFixed(0) + " ms", 2, y(rtt) + 4);
+  }
+
+  // RTT line, broken by the lost probes which are drawn as red ticks
+  ctx.strokeStyle = "rgb(76, 175, 80)";
+  ctx.lineWidth = 1.5;
+  ctx.beginPath();
+  let drawing = false;
+  for (const s of samples) {
+    if (s.lost) {
+      drawing = false;
+      continue;
+    }
+    if (drawing) {
+      ctx.lineTo(x(s.time), y(s.rtt));
+    } else {
+      ctx.moveTo(x(s.time), y(s.rtt));
+      drawing = true;
+    }
+  }
+  ctx.stroke();
+
+  ctx.strokeStyle = "rgb(244, 67, 54)";
+  for (const s of samples.filter(s => s.lost)) {
+    ctx.beginPath();
+    ctx.moveTo(x(s.time), y(0));
+    ctx.lineTo(x(s.time), y(max));
+    ctx.stroke();
+  }
+
+  // Route changes, as on the chart of the application
+  ctx.strokeStyle = "rgb(255, 152, 0)";
+  for (const time of routes.filter(t => now - Date.parse(t) <= ChartWindow)) {
+    ctx.beginPath();
+    ctx.moveTo(x(time), y(0));
+    ctx.lineTo(x(time), y(max));
+    ctx.stroke();
+  }
+  ctx.lineWidth = 1;
+}
+
+// ****************************************************************************
+// Incident log
+// ****************************************************************************
+async function refreshIncidents() {
+  const path = selected ? "data/incidents?target=" + encodeURIComponent(selected) : "data/incidents";
+  let incidents;
+  try {
+    incidents = await fetchJSON(path);
+  } catch (err) {
+    return;
+  }
+  document.querySelector("#incidents-title").textContent = selected ? "Incidents of " + selected : "Incidents";
+  if (selected) {
+    routes = incidents.filter(ev => ev.type === "route").map(ev => ev.time);
+    drawChart();
+  }
+  const body = document.querySelector("#incidents tbody");
+  body.replaceChildren();
+  for (const ev of incidents.slice(-IncidentsShown).reverse()) {
+    const row = document.createElement("tr");
+    row.append(
+      cell(new Date(ev.time).toLocaleString()),
+      cell(ev.target),
+      cell(ev.type),
+      cell(ev.message),
+    );
+    body.append(row);
+  }
+}
+
+// ****************************************************************************
+// Live updates
+// ****************************************************************************
+function connect() {
+  const status = document.querySelector("#connection");
+  const stream = new EventSource("data/stream");
+  stream.onopen = () => {
+    status.textContent = "live";
+    status.className = "online";
+  };
+  stream.onerror = () => {
+    status.textContent = "offline";
+    status.className = "offline";
+  };
+  stream.addEventListener("sample", e => {
+    const ev = JSON.parse(e.data);
+    if (ev.address === selected) {
+      samples.push({ time: ev.time, rtt: ev.rtt || 0, lost: !!ev.lost });
+      drawChart();
+    }
+    scheduleRefresh();
+  });
+  for (const type of ["state", "flapping", "anomaly", "route", "dropped"]) {
+    stream.addEventListener(type, scheduleRefresh);
+  }
+}
+
+refreshTargets();
+refreshIncidents();
+connect();